@@ -2,25 +2,43 @@ package main
 
 import (
 	"flag"
+	"fmt"
 	"github.com/yoojia/go-gecko/v2"
 	"github.com/yoojia/go-gecko/v2/lua"
 	"github.com/yoojia/go-gecko/v2/network"
 	"github.com/yoojia/go-gecko/v2/nop"
 	"github.com/yoojia/go-gecko/v2/serial"
+	"os"
 )
 
 // Main
 func main() {
+	// 脚本测试命令： go-gecko test-script cases.yaml [cases.toml ...]
+	if len(os.Args) > 1 && "test-script" == os.Args[1] {
+		os.Exit(testScript(os.Args[2:]))
+	}
 	confPtr := flag.String("c", "conf.d", "a file or dir path")
+	flag.Parse()
 	// 默认Log方式
 	gecko.Bootstrap(*confPtr, func(pipeline *gecko.Pipeline) {
 		// 通常使用这个函数来注册组件工厂函数
 		pipeline.AddCodecFactory(gecko.JSONDefaultEncoderFactory())
 		pipeline.AddCodecFactory(gecko.JSONDefaultDecoderFactory())
+		pipeline.AddCodecFactory(gecko.KVTextEncoderFactory())
+		pipeline.AddCodecFactory(gecko.KVTextDecoderFactory())
+		pipeline.AddFactory(gecko.CSVTextDecoderFactory())
+		pipeline.AddFactory(gecko.CSVTextEncoderFactory())
+		pipeline.AddFactory(gecko.RegexTextDecoderFactory())
+		pipeline.AddFactory(gecko.TemplateTextEncoderFactory())
 
 		pipeline.AddFactory(lua.ScriptDriverFactory())
 		pipeline.AddFactory(lua.ScriptTriggerFactory())
 		pipeline.AddFactory(lua.ScriptOutputFactory())
+		pipeline.AddFactory(lua.ScriptDecoderFactory())
+		pipeline.AddFactory(lua.ScriptEncoderFactory())
+		pipeline.AddFactory(lua.ScriptInputDeviceFactory())
+		pipeline.AddFactory(lua.ScriptLogicDeviceFactory())
+		pipeline.AddFactory(lua.ScriptInterceptorFactory())
 
 		pipeline.AddFactory(network.UDPInputDeviceFactory())
 		pipeline.AddFactory(network.UDPOutputDeviceFactory())
@@ -33,7 +51,42 @@ func main() {
 		pipeline.AddFactory(nop.NopInputDeviceFactory())
 		pipeline.AddFactory(nop.NopDriverFactory())
 		pipeline.AddFactory(nop.NopInterceptorFactor())
+		pipeline.AddFactory(nop.NopOutboundInterceptorFactory())
 		pipeline.AddFactory(nop.NopPluginFactory())
 		pipeline.AddFactory(nop.NopLogicDeviceFactory())
 	})
 }
+
+// 执行脚本测试用例文件，返回进程退出码：全部通过时为0
+func testScript(files []string) int {
+	if 0 == len(files) {
+		fmt.Println("Usage: go-gecko test-script <cases.yaml|cases.toml|cases.json> ...")
+		return 2
+	}
+	failed := 0
+	for _, file := range files {
+		results, err := lua.RunScriptTestFile(file)
+		if nil != err {
+			fmt.Printf("ERROR %s: %s\n", file, err)
+			failed++
+			continue
+		}
+		for _, r := range results {
+			if r.Passed() {
+				fmt.Printf("PASS  %s: %s\n", file, r.Name)
+			} else {
+				failed++
+				fmt.Printf("FAIL  %s: %s\n", file, r.Name)
+				for _, f := range r.Failures {
+					fmt.Printf("      %s\n", f)
+				}
+			}
+		}
+	}
+	if failed > 0 {
+		fmt.Printf("%d failed\n", failed)
+		return 1
+	}
+	fmt.Println("all passed")
+	return 0
+}
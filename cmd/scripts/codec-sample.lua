@@ -0,0 +1,34 @@
+--[[
+    Decoder脚本入口函数，将 KEY=VALUE;KEY=VALUE 格式的文本数据解码成Table
+    @Param frames 原始字节数据的字符串
+    @Return 返回两个参数：
+        1. Table 解码结果；
+        2. Error 错误；
+]]--
+
+function decodeMain(frames)
+    local fields = {}
+    for key, value in string.gmatch(frames, "([^;=]+)=([^;\r\n]*)") do
+        fields[key] = value
+    end
+    return fields, nil
+end
+
+--[[
+    Encoder脚本入口函数，将Table编码成 KEY=VALUE;KEY=VALUE 格式的文本数据
+    @Param fields 消息数据Table；其中 fields.frames 为原始字节数据的字符串
+    @Return 返回两个参数：
+        1. String 编码结果；
+        2. Error 错误；
+]]--
+
+function encodeMain(fields)
+    local pairs_ = {}
+    for key, value in pairs(fields) do
+        if key ~= "frames" then
+            table.insert(pairs_, key .. "=" .. tostring(value))
+        end
+    end
+    table.sort(pairs_)
+    return table.concat(pairs_, ";") .. "\r\n", nil
+end
@@ -1,18 +1,21 @@
 --[[
     Driver脚本入口函数
     @Param args 配置文件定义的参数列表
-    @Param inbound 事件输入参数
+    @Param inbound 事件输入参数；其中 inbound.frames 为原始字节数据的字符串
     @Param deliverFn Deliver函数，原型为： function(targetUuid, payloadTable) (respTable, error)
     @Return 返回两个参数：
         1. Table 处理结果；
         2. Error 错误；
 ]]--
 
+-- gecko模块提供日志、Context、编码、字节和时间等函数
+local gecko = require("gecko")
+
 function driverMain(args, inbound, deliverFn)
     uuid = args["targetUuid"]
-    print("Target UUID: " .. uuid)
+    gecko.info("ScriptDriver", "targetUuid", uuid, "nodeId", gecko.nodeId())
     print(type(deliverFn))
-    ret, err = deliverFn(uuid, { foo = "bar" })
+    ret, err = deliverFn(uuid, { foo = "bar", time = gecko.time.format(gecko.time.unix()) })
     print(ret)
     print(err)
     return ret, err
@@ -0,0 +1,18 @@
+--[[
+    InputDevice脚本入口函数，运行在独立的LState中
+    @Param args 配置文件定义的参数列表
+    @Param deliverFn Deliver函数，原型为： function(frames [, topic]) (respFrames, error)
+    @Return Error 错误；设备停止时脚本被中断
+]]--
+
+function serveMain(args, deliverFn)
+    local seq = 0
+    while true do
+        seq = seq + 1
+        local ret, err = deliverFn('{"seq": ' .. seq .. '}')
+        if err ~= nil then
+            print(err)
+        end
+        sleep(args["periodMs"] or 1000)
+    end
+end
@@ -0,0 +1,25 @@
+--[[
+    Interceptor脚本入口函数
+    @Param args 配置文件定义的参数列表
+    @Param request 事件请求参数，包含 attrs, topic, uuid, inbound 字段
+    @Return 返回两个参数：
+        1. String 处理结果："next" 继续处理；"drop" 中断事件；其它字符串为错误信息；
+           或者Table处理指令：
+           { action = "drop", reason = "原因代码" } 附带原因代码中断事件；
+           { action = "reply", outbound = {...} } 使用自定义消息响应并中断事件；
+           { action = "next", inbound = {...} } 替换Inbound消息并继续处理；
+        2. Table 需要添加到Session属性的数据，可为nil；
+]]--
+
+function interceptMain(args, request)
+    local card = tostring(request.inbound["card"])
+    for _, blocked in ipairs(args["blacklist"] or {}) do
+        if card == tostring(blocked) then
+            return { action = "drop", reason = "BLACKLIST" }, { ["@Script.Blocked"] = card }
+        end
+    end
+    if card == tostring(args["guestCard"]) then
+        return { action = "reply", outbound = { door = "open", guest = true } }, nil
+    end
+    return "next", nil
+end
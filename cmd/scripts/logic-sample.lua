@@ -0,0 +1,16 @@
+--[[
+    LogicDevice脚本：多门控制板的逻辑设备映射规则
+    @Param args 配置文件定义的参数列表
+    @Param inbound 事件输入参数
+]]--
+
+-- 检查输入数据是否属于当前逻辑设备，返回 true/false
+function checkIfMatch(args, inbound)
+    return tostring(inbound["door"]) == tostring(args["door"])
+end
+
+-- 转换输入数据，返回新的数据Table
+function transform(args, inbound)
+    inbound["logicDoor"] = args["door"]
+    return inbound
+end
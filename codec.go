@@ -4,6 +4,8 @@ import (
 	"encoding/json"
 	"github.com/pkg/errors"
 	"github.com/yoojia/go-value"
+	"sync"
+	"time"
 )
 
 //
@@ -32,23 +34,58 @@ type Fields interface {
 	// 获取Int64类型的属性
 	GetFieldInt64(key string) (int64, bool)
 
+	// 获取Float64类型的属性
+	GetFieldFloat64(key string) (float64, bool)
+
+	// 获取Bool类型的属性
+	GetFieldBool(key string) (bool, bool)
+
+	// 获取Time类型的属性。支持time.Time、Unix秒数值和RFC3339格式字符串
+	GetFieldTime(key string) (time.Time, bool)
+
+	// 获取字节数组类型的属性
+	GetFieldBytes(key string) ([]byte, bool)
+
+	// 获取Map类型的属性
+	GetFieldMap(key string) (map[string]interface{}, bool)
+
+	// 获取Slice类型的属性
+	GetFieldSlice(key string) ([]interface{}, bool)
+
+	// 按路径获取属性。路径格式为 `a.b[2].c` 或者JSON-Pointer格式 `/a/b/2/c`
+	GetFieldPath(path string) (interface{}, bool)
+
+	// 按路径设置属性。路径中间不存在的Map节点将被创建；Slice下标越界时返回错误。
+	// 路径上的Map/Slice节点以写时复制方式修改，不影响已经读取的嵌套对象。
+	SetFieldPath(path string, value interface{}) error
+
+	// 删除属性
+	RemoveField(key string)
+
 	// 判断属性是否存在
 	HasField(key string) bool
 }
 
+// fieldsMap 内部使用读写锁保护，同一个MessagePacket可以被Driver和多个Trigger并发读写。
+// 注意：GetField等函数返回的嵌套Map/Slice对象是共享的，只能读取不能直接修改。
+// SetFieldPath 以写时复制方式修改嵌套数据，不会影响其它协程已读取的对象；也可以先 Clone 消息包再修改。
 type fieldsMap struct {
 	Fields
+	mu   sync.RWMutex
 	data map[string]interface{}
 }
 
+// 迭代的是属性快照，consumer内部可以安全地修改属性。
 func (a *fieldsMap) RangeFields(consumer func(name string, value interface{})) {
-	for k, v := range a.data {
+	for k, v := range a.GetFields() {
 		consumer(k, v)
 	}
 }
 
 func (a *fieldsMap) GetFields() map[string]interface{} {
-	rom := make(map[string]interface{})
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	rom := make(map[string]interface{}, len(a.data))
 	for k, v := range a.data {
 		rom[k] = v
 	}
@@ -56,16 +93,20 @@ func (a *fieldsMap) GetFields() map[string]interface{} {
 }
 
 func (a *fieldsMap) AddField(key string, value interface{}) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
 	a.data[key] = value
 }
 
 func (a *fieldsMap) GetField(key string) (interface{}, bool) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
 	v, ok := a.data[key]
 	return v, ok
 }
 
 func (a *fieldsMap) GetFieldOrNil(key string) interface{} {
-	v, ok := a.data[key]
+	v, ok := a.GetField(key)
 	if ok {
 		return v
 	} else {
@@ -74,7 +115,7 @@ func (a *fieldsMap) GetFieldOrNil(key string) interface{} {
 }
 
 func (a *fieldsMap) GetFieldString(key string) (string, bool) {
-	val, ok := a.data[key]
+	val, ok := a.GetField(key)
 	if ok {
 		return value.ToString(val), true
 	} else {
@@ -83,7 +124,7 @@ func (a *fieldsMap) GetFieldString(key string) (string, bool) {
 }
 
 func (a *fieldsMap) GetFieldInt64(key string) (int64, bool) {
-	val, ok := a.data[key]
+	val, ok := a.GetField(key)
 	if ok {
 		return value.ToInt64(val)
 	} else {
@@ -91,34 +132,144 @@ func (a *fieldsMap) GetFieldInt64(key string) (int64, bool) {
 	}
 }
 
+func (a *fieldsMap) GetFieldFloat64(key string) (float64, bool) {
+	if val, ok := a.GetField(key); ok {
+		return toFloat64(val)
+	} else {
+		return 0, false
+	}
+}
+
+func (a *fieldsMap) GetFieldBool(key string) (bool, bool) {
+	if val, ok := a.GetField(key); ok {
+		return toBool(val)
+	} else {
+		return false, false
+	}
+}
+
+func (a *fieldsMap) GetFieldTime(key string) (time.Time, bool) {
+	if val, ok := a.GetField(key); ok {
+		return toTime(val)
+	} else {
+		return time.Time{}, false
+	}
+}
+
+func (a *fieldsMap) GetFieldBytes(key string) ([]byte, bool) {
+	if val, ok := a.GetField(key); ok {
+		return toBytes(val)
+	} else {
+		return nil, false
+	}
+}
+
+func (a *fieldsMap) GetFieldMap(key string) (map[string]interface{}, bool) {
+	if val, ok := a.GetField(key); ok {
+		return toMap(val)
+	} else {
+		return nil, false
+	}
+}
+
+func (a *fieldsMap) GetFieldSlice(key string) ([]interface{}, bool) {
+	if val, ok := a.GetField(key); ok {
+		return toSlice(val)
+	} else {
+		return nil, false
+	}
+}
+
+func (a *fieldsMap) GetFieldPath(path string) (interface{}, bool) {
+	tokens, err := parseFieldPath(path)
+	if nil != err {
+		return nil, false
+	}
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return lookupFieldPath(a.data, tokens)
+}
+
+// 使用已解析的字段路径读取字段值
+func (a *fieldsMap) lookupFieldTokens(tokens []fieldPathToken) (interface{}, bool) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return lookupFieldPath(a.data, tokens)
+}
+
+func (a *fieldsMap) SetFieldPath(path string, value interface{}) error {
+	tokens, err := parseFieldPath(path)
+	if nil != err {
+		return err
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	data, err := assignFieldPath(a.data, tokens, value)
+	if nil != err {
+		return err
+	}
+	a.data = data
+	return nil
+}
+
+func (a *fieldsMap) RemoveField(key string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	delete(a.data, key)
+}
+
 func (a *fieldsMap) HasField(key string) bool {
-	_, ok := a.data[key]
+	_, ok := a.GetField(key)
 	return ok
 }
 
+// 返回深度复制的属性列表
+func (a *fieldsMap) copyFields() map[string]interface{} {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return deepCopyMap(a.data)
+}
+
 func newMapFields() *fieldsMap {
 	return &fieldsMap{data: make(map[string]interface{})}
 }
 
-// 对象数据消息包
+// 对象数据消息包。
+// MessagePacket 可以在Driver和Trigger之间共享，其Fields和Frames的读写操作是并发安全的。
 type MessagePacket struct {
 	*fieldsMap
-	frames []byte
+	framesMu sync.RWMutex
+	frames   []byte
 }
 
 func (m *MessagePacket) GetFrames() []byte {
+	m.framesMu.RLock()
+	defer m.framesMu.RUnlock()
 	return m.frames
 }
 
 func (m *MessagePacket) GetFramesStr() string {
-	return string(m.frames)
+	return string(m.GetFrames())
 }
 
 func (m *MessagePacket) SetFrames(b []byte) *MessagePacket {
+	m.framesMu.Lock()
+	defer m.framesMu.Unlock()
 	m.frames = b
 	return m
 }
 
+// 返回深度复制的消息包。Fields中嵌套的Map和Slice，以及Frames字段均被复制。
+// 需要修改共享消息包的嵌套数据时，应当先复制再修改。
+func (m *MessagePacket) Clone() *MessagePacket {
+	var frames []byte
+	if src := m.GetFrames(); nil != src {
+		frames = make([]byte, len(src))
+		copy(frames, src)
+	}
+	return NewMessagePacketWith(m.copyFields(), frames)
+}
+
 func NewMessagePacketWith(fields map[string]interface{}, frames []byte) *MessagePacket {
 	m := newMapFields()
 	for k, v := range fields {
@@ -176,6 +327,18 @@ func (e Encoder) Encode(data *MessagePacket) (FramePacket, error) {
 	return e(data)
 }
 
+// 可配置的解码器组件。
+// 在[CODECS]配置项中声明，由组件工厂函数创建，以配置项的name（默认为配置Key）作为Decoder名称注册。
+// 组件可以实现 Initial/StructuredInitial 和 LifeCycle 接口。
+type DecoderComponent interface {
+	Decode(frames FramePacket) (*MessagePacket, error)
+}
+
+// 可配置的编码器组件。参见 DecoderComponent
+type EncoderComponent interface {
+	Encode(data *MessagePacket) (FramePacket, error)
+}
+
 //// 系统默认实现的编码和解码接口
 
 func NopEncoder(_ *MessagePacket) (FramePacket, error) {
@@ -214,7 +377,7 @@ func JSONDefaultEncoderFactory() (string, CodecFactory) {
 // 默认JSON编码器，负责将MessagePacket.Fields对象解析成Byte数组
 // 注意：JSON编码器将Fields字段转换成JSON字节数组，忽略Frames字段。
 func JSONDefaultEncoder(msg *MessagePacket) (FramePacket, error) {
-	return json.Marshal(msg.data)
+	return json.Marshal(msg.GetFields())
 }
 
 ////
@@ -232,7 +395,7 @@ func FrameDefaultDecoderFactory() (string, CodecFactory) {
 
 // 字节帧编码器，负责将MessagePacket.Frames转换成FramePacket。其中Fields字段被忽略。
 func FrameDefaultEncoder(msg *MessagePacket) (FramePacket, error) {
-	return msg.frames, nil
+	return msg.GetFrames(), nil
 }
 
 func FrameDefaultEncoderFactory() (string, CodecFactory) {
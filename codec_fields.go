@@ -0,0 +1,337 @@
+package gecko
+
+import (
+	"github.com/pkg/errors"
+	"github.com/yoojia/go-value"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//
+// Author: 陈哈哈 chenyongjia@parkingwang.com, yoojiachen@gmail.com
+//
+
+// MessagePacket.Fields 的类型转换、路径访问和深度复制函数。
+// JSON解码得到的数据为嵌套的 map[string]interface{} 和 []interface{} 结构，路径访问可以直接读写嵌套字段。
+
+func toFloat64(val interface{}) (float64, bool) {
+	switch v := val.(type) {
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		i, ok := value.ToInt64(v)
+		return float64(i), ok
+	case bool:
+		if v {
+			return 1, true
+		}
+		return 0, true
+	default:
+		f, err := strconv.ParseFloat(strings.TrimSpace(value.ToString(val)), 64)
+		return f, nil == err
+	}
+}
+
+func toBool(val interface{}) (bool, bool) {
+	switch v := val.(type) {
+	case bool:
+		return v, true
+	case string:
+		b, err := strconv.ParseBool(strings.TrimSpace(v))
+		return b, nil == err
+	default:
+		if f, ok := toFloat64(val); ok {
+			return 0 != f, true
+		}
+		return false, false
+	}
+}
+
+func toTime(val interface{}) (time.Time, bool) {
+	switch v := val.(type) {
+	case time.Time:
+		return v, true
+	case string:
+		for _, layout := range []string{time.RFC3339Nano, "2006-01-02 15:04:05", "2006-01-02"} {
+			if t, err := time.ParseInLocation(layout, v, time.Local); nil == err {
+				return t, true
+			}
+		}
+		return time.Time{}, false
+	default:
+		if f, ok := toFloat64(val); ok {
+			sec := int64(f)
+			return time.Unix(sec, int64((f-float64(sec))*1e9)), true
+		}
+		return time.Time{}, false
+	}
+}
+
+func toBytes(val interface{}) ([]byte, bool) {
+	switch v := val.(type) {
+	case []byte:
+		return v, true
+	case string:
+		return []byte(v), true
+	default:
+		return nil, false
+	}
+}
+
+func toMap(val interface{}) (map[string]interface{}, bool) {
+	switch v := val.(type) {
+	case map[string]interface{}:
+		return v, true
+	case map[interface{}]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for k, item := range v {
+			out[value.ToString(k)] = item
+		}
+		return out, true
+	default:
+		return nil, false
+	}
+}
+
+func toSlice(val interface{}) ([]interface{}, bool) {
+	if v, ok := val.([]interface{}); ok {
+		return v, true
+	}
+	if nil == val {
+		return nil, false
+	}
+	rv := reflect.ValueOf(val)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return nil, false
+	}
+	// 字节数组不作为Slice处理
+	if rv.Type().Elem().Kind() == reflect.Uint8 {
+		return nil, false
+	}
+	out := make([]interface{}, rv.Len())
+	for i := range out {
+		out[i] = rv.Index(i).Interface()
+	}
+	return out, true
+}
+
+////
+
+type fieldPathToken struct {
+	name  string
+	index bool // 是否为[n]格式的下标
+}
+
+// 解析字段路径。支持两种格式：
+// 1. 点号格式：`a.b[2].c`；
+// 2. JSON-Pointer格式：`/a/b/2/c`，其中 `~1` 表示 `/`，`~0` 表示 `~`；
+func parseFieldPath(path string) ([]fieldPathToken, error) {
+	if "" == path {
+		return nil, errors.New("field path is empty")
+	}
+	tokens := make([]fieldPathToken, 0)
+	if '/' == path[0] {
+		for _, seg := range strings.Split(path[1:], "/") {
+			seg = strings.Replace(strings.Replace(seg, "~1", "/", -1), "~0", "~", -1)
+			tokens = append(tokens, fieldPathToken{name: seg})
+		}
+		return tokens, nil
+	}
+	for _, seg := range strings.Split(path, ".") {
+		name := seg
+		indexes := ""
+		if idx := strings.IndexByte(seg, '['); idx >= 0 {
+			name, indexes = seg[:idx], seg[idx:]
+		}
+		if "" == name && "" == indexes {
+			return nil, errors.Errorf("invalid field path: %s", path)
+		}
+		if "" != name {
+			tokens = append(tokens, fieldPathToken{name: name})
+		}
+		for "" != indexes {
+			end := strings.IndexByte(indexes, ']')
+			if '[' != indexes[0] || end < 0 {
+				return nil, errors.Errorf("invalid field path: %s", path)
+			}
+			if _, err := strconv.Atoi(indexes[1:end]); nil != err {
+				return nil, errors.Errorf("invalid index in field path: %s", path)
+			}
+			tokens = append(tokens, fieldPathToken{name: indexes[1:end], index: true})
+			indexes = indexes[end+1:]
+		}
+	}
+	return tokens, nil
+}
+
+func lookupFieldPath(root map[string]interface{}, tokens []fieldPathToken) (interface{}, bool) {
+	var current interface{} = root
+	for _, tk := range tokens {
+		next, ok := getChild(current, tk)
+		if !ok {
+			return nil, false
+		}
+		current = next
+	}
+	return current, true
+}
+
+func getChild(container interface{}, tk fieldPathToken) (interface{}, bool) {
+	switch c := container.(type) {
+	case map[string]interface{}:
+		if tk.index {
+			return nil, false
+		}
+		v, ok := c[tk.name]
+		return v, ok
+	case map[interface{}]interface{}:
+		if tk.index {
+			return nil, false
+		}
+		v, ok := c[tk.name]
+		return v, ok
+	default:
+		items, ok := toSlice(container)
+		if !ok {
+			return nil, false
+		}
+		idx, err := strconv.Atoi(tk.name)
+		if nil != err || idx < 0 || idx >= len(items) {
+			return nil, false
+		}
+		return items[idx], true
+	}
+}
+
+// 按路径写入字段值，返回写入后的新根节点。
+// 路径上的每一个Map/Slice节点都被复制后再修改（写时复制），已被其它协程读取的嵌套对象不会被修改。
+func assignFieldPath(root map[string]interface{}, tokens []fieldPathToken, val interface{}) (map[string]interface{}, error) {
+	out, err := withFieldPath(root, tokens, val)
+	if nil != err {
+		return nil, err
+	}
+	return out.(map[string]interface{}), nil
+}
+
+func withFieldPath(container interface{}, tokens []fieldPathToken, val interface{}) (interface{}, error) {
+	tk := tokens[0]
+	next := val
+	if len(tokens) > 1 {
+		child, ok := getChild(container, tk)
+		if !ok || nil == child {
+			if tokens[1].index {
+				return nil, errors.Errorf("field path node not found: %s", tk.name)
+			}
+			child = make(map[string]interface{})
+		}
+		v, err := withFieldPath(child, tokens[1:], val)
+		if nil != err {
+			return nil, err
+		}
+		next = v
+	}
+	copied := shallowCopyContainer(container)
+	if err := setChild(copied, tk, next); nil != err {
+		return nil, err
+	}
+	return copied, nil
+}
+
+// 浅复制Map/Slice节点；其它类型原样返回
+func shallowCopyContainer(container interface{}) interface{} {
+	switch c := container.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(c)+1)
+		for k, v := range c {
+			out[k] = v
+		}
+		return out
+	case map[interface{}]interface{}:
+		out := make(map[interface{}]interface{}, len(c)+1)
+		for k, v := range c {
+			out[k] = v
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(c))
+		copy(out, c)
+		return out
+	default:
+		return container
+	}
+}
+
+func setChild(container interface{}, tk fieldPathToken, val interface{}) error {
+	switch c := container.(type) {
+	case map[string]interface{}:
+		if tk.index {
+			return errors.Errorf("field path node is not a slice: [%s]", tk.name)
+		}
+		c[tk.name] = val
+		return nil
+	case map[interface{}]interface{}:
+		if tk.index {
+			return errors.Errorf("field path node is not a slice: [%s]", tk.name)
+		}
+		c[tk.name] = val
+		return nil
+	case []interface{}:
+		idx, err := strconv.Atoi(tk.name)
+		if nil != err || idx < 0 || idx >= len(c) {
+			return errors.Errorf("field path index out of range: %s", tk.name)
+		}
+		c[idx] = val
+		return nil
+	default:
+		return errors.Errorf("field path node is not a map or slice: %s", tk.name)
+	}
+}
+
+////
+
+func deepCopyMap(src map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(src))
+	for k, v := range src {
+		out[k] = deepCopyValue(v)
+	}
+	return out
+}
+
+func deepCopyValue(val interface{}) interface{} {
+	switch v := val.(type) {
+	case map[string]interface{}:
+		return deepCopyMap(v)
+	case map[interface{}]interface{}:
+		out := make(map[interface{}]interface{}, len(v))
+		for k, item := range v {
+			out[k] = deepCopyValue(item)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, item := range v {
+			out[i] = deepCopyValue(item)
+		}
+		return out
+	case []map[string]interface{}:
+		out := make([]map[string]interface{}, len(v))
+		for i, item := range v {
+			out[i] = deepCopyMap(item)
+		}
+		return out
+	case []byte:
+		out := make([]byte, len(v))
+		copy(out, v)
+		return out
+	case []string:
+		out := make([]string, len(v))
+		copy(out, v)
+		return out
+	default:
+		return val
+	}
+}
@@ -0,0 +1,145 @@
+package gecko
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func newNestedMessage(t *testing.T) *MessagePacket {
+	msg, err := JSONDefaultDecoder(FramePacket(`{
+		"card": "12345",
+		"door": 2,
+		"ratio": "0.5",
+		"open": "true",
+		"ts": 1546300800,
+		"at": "2019-01-01T00:00:00Z",
+		"reader": {"id": 7, "tags": ["a", "b", {"c": "deep"}]}
+	}`))
+	assert.NoError(t, err)
+	return msg
+}
+
+func TestFieldsTypedAccessors(t *testing.T) {
+	msg := newNestedMessage(t)
+
+	f, ok := msg.GetFieldFloat64("ratio")
+	assert.True(t, ok)
+	assert.Equal(t, 0.5, f)
+
+	b, ok := msg.GetFieldBool("open")
+	assert.True(t, ok)
+	assert.True(t, b)
+
+	b, ok = msg.GetFieldBool("door")
+	assert.True(t, ok)
+	assert.True(t, b)
+
+	_, ok = msg.GetFieldBool("card-none")
+	assert.False(t, ok)
+
+	ts, ok := msg.GetFieldTime("ts")
+	assert.True(t, ok)
+	assert.Equal(t, int64(1546300800), ts.Unix())
+
+	at, ok := msg.GetFieldTime("at")
+	assert.True(t, ok)
+	assert.Equal(t, int64(1546300800), at.Unix())
+
+	bs, ok := msg.GetFieldBytes("card")
+	assert.True(t, ok)
+	assert.Equal(t, []byte("12345"), bs)
+
+	m, ok := msg.GetFieldMap("reader")
+	assert.True(t, ok)
+	assert.Equal(t, float64(7), m["id"])
+
+	_, ok = msg.GetFieldMap("card")
+	assert.False(t, ok)
+
+	msg.AddField("ints", []int64{1, 2, 3})
+	s, ok := msg.GetFieldSlice("ints")
+	assert.True(t, ok)
+	assert.Equal(t, []interface{}{int64(1), int64(2), int64(3)}, s)
+
+	_, ok = msg.GetFieldSlice("card")
+	assert.False(t, ok)
+}
+
+func TestFieldsPathLookup(t *testing.T) {
+	msg := newNestedMessage(t)
+	cases := map[string]interface{}{
+		"reader.id":        float64(7),
+		"reader.tags[1]":   "b",
+		"reader.tags[2].c": "deep",
+		"/reader/tags/2/c": "deep",
+		"/reader/id":       float64(7),
+		"card":             "12345",
+	}
+	for path, expected := range cases {
+		v, ok := msg.GetFieldPath(path)
+		assert.True(t, ok, path)
+		assert.Equal(t, expected, v, path)
+	}
+	for _, path := range []string{"", "none", "reader.none", "reader.tags[9]", "reader.id.x", "reader[0]", "reader.tags[x]", "a..b"} {
+		_, ok := msg.GetFieldPath(path)
+		assert.False(t, ok, path)
+	}
+}
+
+func TestFieldsPathSet(t *testing.T) {
+	msg := newNestedMessage(t)
+	assert.NoError(t, msg.SetFieldPath("reader.tags[2].c", "changed"))
+	assert.NoError(t, msg.SetFieldPath("reader.tags[0]", "z"))
+	assert.NoError(t, msg.SetFieldPath("/new/node/value", 1))
+	assert.NoError(t, msg.SetFieldPath("x.y", true))
+
+	v, _ := msg.GetFieldPath("reader.tags[2].c")
+	assert.Equal(t, "changed", v)
+	v, _ = msg.GetFieldPath("reader.tags[0]")
+	assert.Equal(t, "z", v)
+	v, _ = msg.GetFieldPath("new.node.value")
+	assert.Equal(t, 1, v)
+	v, _ = msg.GetFieldPath("x.y")
+	assert.Equal(t, true, v)
+
+	assert.Error(t, msg.SetFieldPath("reader.tags[5]", 1))
+	assert.Error(t, msg.SetFieldPath("card.x", 1))
+	assert.Error(t, msg.SetFieldPath("none[0]", 1))
+	assert.Error(t, msg.SetFieldPath("", 1))
+}
+
+// SetFieldPath 不修改已经读取的嵌套对象
+func TestFieldsPathSetCopyOnWrite(t *testing.T) {
+	msg := newNestedMessage(t)
+	reader, _ := msg.GetFieldMap("reader")
+	tags, _ := msg.GetFieldPath("reader.tags")
+	assert.NoError(t, msg.SetFieldPath("reader.tags[0]", "z"))
+	assert.NoError(t, msg.SetFieldPath("reader.added", 1))
+
+	assert.NotEqual(t, "z", tags.([]interface{})[0])
+	_, ok := reader["added"]
+	assert.False(t, ok)
+	v, _ := msg.GetFieldPath("reader.tags[0]")
+	assert.Equal(t, "z", v)
+
+	// 写入失败时不创建中间节点
+	assert.Error(t, msg.SetFieldPath("created.card.x[0]", 1))
+	assert.False(t, msg.HasField("created"))
+}
+
+func TestFieldsRemoveAndClone(t *testing.T) {
+	msg := newNestedMessage(t)
+	msg.RemoveField("card")
+	assert.False(t, msg.HasField("card"))
+
+	msg.AddField("at", time.Unix(0, 0))
+	cloned := msg.Clone()
+	assert.NoError(t, cloned.SetFieldPath("reader.tags[2].c", "cloned"))
+	cloned.GetFrames()[0] = 'X'
+
+	v, _ := msg.GetFieldPath("reader.tags[2].c")
+	assert.Equal(t, "deep", v)
+	assert.NotEqual(t, byte('X'), msg.GetFrames()[0])
+	assert.Equal(t, msg.GetFieldOrNil("at"), cloned.GetFieldOrNil("at"))
+}
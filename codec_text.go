@@ -0,0 +1,321 @@
+package gecko
+
+import (
+	"bytes"
+	"encoding/csv"
+	"github.com/pkg/errors"
+	"github.com/yoojia/go-gecko/v2/utils"
+	"github.com/yoojia/go-value"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+//
+// Author: 陈哈哈 chenyongjia@parkingwang.com, yoojiachen@gmail.com
+//
+
+// 文本行协议的编码解码器。
+// 大部分读卡器、控制板使用ASCII文本行协议，例如：`CARD=12345;DOOR=2\r\n`，或者CSV格式数据行。
+// 文本解码器将数据行解析到MessagePacket.Fields字段，字段值均为字符串类型；原始数据保存在Frames字段。
+
+const textLineCutset = "\r\n"
+
+func trimTextLine(frame FramePacket) string {
+	return strings.TrimRight(string(frame), textLineCutset)
+}
+
+////
+
+// 创建KeyValue文本解码器。
+// @param pairSep 键值对之间的分隔符，例如 ";"
+// @param kvSep 键与值之间的分隔符，例如 "="
+func NewKVTextDecoder(pairSep, kvSep string) Decoder {
+	return func(frame FramePacket) (*MessagePacket, error) {
+		fields := make(map[string]interface{})
+		for _, pair := range strings.Split(trimTextLine(frame), pairSep) {
+			if "" == strings.TrimSpace(pair) {
+				continue
+			}
+			kv := strings.SplitN(pair, kvSep, 2)
+			if 2 != len(kv) {
+				return nil, errors.Errorf("kv text decode failed, invalid pair: %s", pair)
+			}
+			key := strings.TrimSpace(kv[0])
+			if "" == key {
+				return nil, errors.Errorf("kv text decode failed, empty key: %s", pair)
+			}
+			fields[key] = strings.TrimSpace(kv[1])
+		}
+		return NewMessagePacketWith(fields, frame), nil
+	}
+}
+
+// 创建KeyValue文本编码器。字段按Key排序后输出，保证相同数据的编码结果一致。
+// @param lineEnd 数据行结束符，例如 "\r\n"；不需要时为空字符串
+func NewKVTextEncoder(pairSep, kvSep, lineEnd string) Encoder {
+	return func(msg *MessagePacket) (FramePacket, error) {
+		fields := msg.GetFields()
+		keys := make([]string, 0, len(fields))
+		for k := range fields {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		buf := new(bytes.Buffer)
+		for i, k := range keys {
+			if i > 0 {
+				buf.WriteString(pairSep)
+			}
+			buf.WriteString(k)
+			buf.WriteString(kvSep)
+			buf.WriteString(value.ToString(fields[k]))
+		}
+		buf.WriteString(lineEnd)
+		return buf.Bytes(), nil
+	}
+}
+
+func KVTextDecoderFactory() (string, CodecFactory) {
+	return "KVTextDecoder", func() interface{} {
+		return NewKVTextDecoder(";", "=")
+	}
+}
+
+func KVTextEncoderFactory() (string, CodecFactory) {
+	return "KVTextEncoder", func() interface{} {
+		return NewKVTextEncoder(";", "=", "\r\n")
+	}
+}
+
+////
+
+// 创建CSV文本解码器。每个数据帧为一行CSV记录，按header指定的字段名顺序解析。
+func NewCSVTextDecoder(header []string, comma rune) Decoder {
+	return func(frame FramePacket) (*MessagePacket, error) {
+		reader := csv.NewReader(strings.NewReader(trimTextLine(frame)))
+		reader.Comma = comma
+		reader.TrimLeadingSpace = true
+		record, err := reader.Read()
+		if nil != err {
+			return nil, errors.Wrap(err, "csv text decode failed")
+		}
+		if len(record) != len(header) {
+			return nil, errors.Errorf("csv text decode failed, header size: %d, record size: %d",
+				len(header), len(record))
+		}
+		fields := make(map[string]interface{}, len(header))
+		for i, name := range header {
+			fields[name] = record[i]
+		}
+		return NewMessagePacketWith(fields, frame), nil
+	}
+}
+
+// 创建CSV文本编码器。按header指定的字段名顺序输出一行CSV记录，缺失的字段输出为空。
+func NewCSVTextEncoder(header []string, comma rune) Encoder {
+	return func(msg *MessagePacket) (FramePacket, error) {
+		record := make([]string, len(header))
+		for i, name := range header {
+			if v, ok := msg.GetField(name); ok {
+				record[i] = value.ToString(v)
+			}
+		}
+		buf := new(bytes.Buffer)
+		writer := csv.NewWriter(buf)
+		writer.Comma = comma
+		writer.UseCRLF = true
+		if err := writer.Write(record); nil != err {
+			return nil, errors.Wrap(err, "csv text encode failed")
+		}
+		writer.Flush()
+		if err := writer.Error(); nil != err {
+			return nil, errors.Wrap(err, "csv text encode failed")
+		}
+		return buf.Bytes(), nil
+	}
+}
+
+////
+
+// 创建正则表达式文本解码器。表达式中的命名分组 (?P<name>...) 被解析为同名字段。
+// 数据帧不匹配表达式时，返回错误。
+func NewRegexTextDecoder(expr string) (Decoder, error) {
+	re, err := regexp.Compile(expr)
+	if nil != err {
+		return nil, errors.Wrap(err, "regex text decoder compile failed")
+	}
+	names := re.SubexpNames()
+	return func(frame FramePacket) (*MessagePacket, error) {
+		match := re.FindStringSubmatch(trimTextLine(frame))
+		if nil == match {
+			return nil, errors.New("regex text decode failed, frame not matched")
+		}
+		fields := make(map[string]interface{})
+		for i, name := range names {
+			if "" != name {
+				fields[name] = match[i]
+			}
+		}
+		return NewMessagePacketWith(fields, frame), nil
+	}, nil
+}
+
+// 创建Go模板文本编码器。模板数据为MessagePacket.Fields，例如： `OPEN={{.door}}\r\n`
+func NewTemplateTextEncoder(text string) (Encoder, error) {
+	tpl, err := template.New("TemplateTextEncoder").Parse(text)
+	if nil != err {
+		return nil, errors.Wrap(err, "template text encoder parse failed")
+	}
+	return func(msg *MessagePacket) (FramePacket, error) {
+		buf := new(bytes.Buffer)
+		if err := tpl.Execute(buf, msg.GetFields()); nil != err {
+			return nil, errors.Wrap(err, "template text encode failed")
+		}
+		return buf.Bytes(), nil
+	}, nil
+}
+
+////
+
+// 可配置的CSV文本解码器组件，在[CODECS]中声明，例如：
+//
+//	[CODECS.CardCSVDecoder]
+//	  type = "CSVTextDecoder"
+//	[CODECS.CardCSVDecoder.InitArgs]
+//	  columns = ["card", "door", "time"]
+//	  separator = ","              # 可选，默认为 ","
+type CSVTextDecoder struct {
+	decoder Decoder
+}
+
+func (d *CSVTextDecoder) OnInit(args map[string]interface{}, ctx Context) {
+	d.decoder = NewCSVTextDecoder(textCodecColumns(args, "CSVTextDecoder"), textCodecSeparator(args, "CSVTextDecoder"))
+}
+
+func (d *CSVTextDecoder) Decode(frames FramePacket) (*MessagePacket, error) {
+	if nil == d.decoder {
+		return nil, errors.New("CSVTextDecoder未初始化，缺少配置项[InitArgs]")
+	}
+	return d.decoder(frames)
+}
+
+func CSVTextDecoderFactory() (string, Factory) {
+	return "CSVTextDecoder", func() interface{} {
+		return new(CSVTextDecoder)
+	}
+}
+
+// 可配置的CSV文本编码器组件，配置参数与 CSVTextDecoder 相同
+type CSVTextEncoder struct {
+	encoder Encoder
+}
+
+func (e *CSVTextEncoder) OnInit(args map[string]interface{}, ctx Context) {
+	e.encoder = NewCSVTextEncoder(textCodecColumns(args, "CSVTextEncoder"), textCodecSeparator(args, "CSVTextEncoder"))
+}
+
+func (e *CSVTextEncoder) Encode(data *MessagePacket) (FramePacket, error) {
+	if nil == e.encoder {
+		return nil, errors.New("CSVTextEncoder未初始化，缺少配置项[InitArgs]")
+	}
+	return e.encoder(data)
+}
+
+func CSVTextEncoderFactory() (string, Factory) {
+	return "CSVTextEncoder", func() interface{} {
+		return new(CSVTextEncoder)
+	}
+}
+
+// 可配置的正则表达式文本解码器组件，例如：
+//
+//	[CODECS.CardRegexDecoder]
+//	  type = "RegexTextDecoder"
+//	[CODECS.CardRegexDecoder.InitArgs]
+//	  pattern = '^CARD:(?P<card>\d+),DOOR:(?P<door>\d+)$'
+type RegexTextDecoder struct {
+	decoder Decoder
+}
+
+func (d *RegexTextDecoder) OnInit(args map[string]interface{}, ctx Context) {
+	pattern := value.Of(args["pattern"]).String()
+	if "" == pattern {
+		log.Panicw("RegexTextDecoder配置项[pattern]是必须的")
+	}
+	decoder, err := NewRegexTextDecoder(pattern)
+	if nil != err {
+		log.Panicw("RegexTextDecoder配置项[pattern]错误", "pattern", pattern, "error", err)
+	}
+	d.decoder = decoder
+}
+
+func (d *RegexTextDecoder) Decode(frames FramePacket) (*MessagePacket, error) {
+	if nil == d.decoder {
+		return nil, errors.New("RegexTextDecoder未初始化，缺少配置项[InitArgs]")
+	}
+	return d.decoder(frames)
+}
+
+func RegexTextDecoderFactory() (string, Factory) {
+	return "RegexTextDecoder", func() interface{} {
+		return new(RegexTextDecoder)
+	}
+}
+
+// 可配置的Go模板文本编码器组件，例如：
+//
+//	[CODECS.DoorTemplateEncoder]
+//	  type = "TemplateTextEncoder"
+//	[CODECS.DoorTemplateEncoder.InitArgs]
+//	  template = "OPEN={{.door}}\r\n"
+type TemplateTextEncoder struct {
+	encoder Encoder
+}
+
+func (e *TemplateTextEncoder) OnInit(args map[string]interface{}, ctx Context) {
+	text := value.Of(args["template"]).String()
+	if "" == text {
+		log.Panicw("TemplateTextEncoder配置项[template]是必须的")
+	}
+	encoder, err := NewTemplateTextEncoder(text)
+	if nil != err {
+		log.Panicw("TemplateTextEncoder配置项[template]错误", "template", text, "error", err)
+	}
+	e.encoder = encoder
+}
+
+func (e *TemplateTextEncoder) Encode(data *MessagePacket) (FramePacket, error) {
+	if nil == e.encoder {
+		return nil, errors.New("TemplateTextEncoder未初始化，缺少配置项[InitArgs]")
+	}
+	return e.encoder(data)
+}
+
+func TemplateTextEncoderFactory() (string, Factory) {
+	return "TemplateTextEncoder", func() interface{} {
+		return new(TemplateTextEncoder)
+	}
+}
+
+// 读取CSV编解码器的字段名列表
+func textCodecColumns(args map[string]interface{}, typeName string) []string {
+	columns := utils.ToStringArray(args["columns"])
+	if 0 == len(columns) {
+		log.Panicw("配置项[columns]必须是非空字符串数组", "type", typeName)
+	}
+	return columns
+}
+
+// 读取CSV编解码器的分隔符，默认为 ","
+func textCodecSeparator(args map[string]interface{}, typeName string) rune {
+	sep := value.Of(args["separator"]).String()
+	if "" == sep {
+		return ','
+	}
+	runes := []rune(sep)
+	if 1 != len(runes) || '"' == runes[0] || '\r' == runes[0] || '\n' == runes[0] {
+		log.Panicw("配置项[separator]必须是单个字符", "type", typeName, "separator", sep)
+	}
+	return runes[0]
+}
@@ -0,0 +1,112 @@
+package gecko
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestKVTextCodec(t *testing.T) {
+	_, factory := KVTextDecoderFactory()
+	decoder := factory().(Decoder)
+	msg, err := decoder.Decode(FramePacket("CARD=12345; DOOR=2\r\n"))
+	assert.NoError(t, err)
+	assert.Equal(t, "12345", msg.GetFieldOrNil("CARD"))
+	assert.Equal(t, "2", msg.GetFieldOrNil("DOOR"))
+
+	_, err = decoder.Decode(FramePacket("CARD"))
+	assert.Error(t, err)
+
+	encoder := NewKVTextEncoder(";", "=", "\r\n")
+	frame, err := encoder.Encode(msg)
+	assert.NoError(t, err)
+	assert.Equal(t, "CARD=12345;DOOR=2\r\n", string(frame))
+}
+
+func TestCSVTextCodec(t *testing.T) {
+	header := []string{"card", "door", "time"}
+	msg, err := NewCSVTextDecoder(header, ',').Decode(FramePacket("12345, 2,\"2019-01-01 08:00\"\n"))
+	assert.NoError(t, err)
+	assert.Equal(t, "12345", msg.GetFieldOrNil("card"))
+	assert.Equal(t, "2", msg.GetFieldOrNil("door"))
+	assert.Equal(t, "2019-01-01 08:00", msg.GetFieldOrNil("time"))
+
+	_, err = NewCSVTextDecoder(header, ',').Decode(FramePacket("12345,2"))
+	assert.Error(t, err)
+
+	frame, err := NewCSVTextEncoder([]string{"door", "card", "none"}, ';').Encode(msg)
+	assert.NoError(t, err)
+	assert.Equal(t, "2;12345;\r\n", string(frame))
+}
+
+func TestRegexTextDecoder(t *testing.T) {
+	decoder, err := NewRegexTextDecoder(`^@(?P<reader>\d+):(?P<card>[0-9A-F]+)$`)
+	assert.NoError(t, err)
+	msg, err := decoder.Decode(FramePacket("@01:ABCD1234\r\n"))
+	assert.NoError(t, err)
+	assert.Equal(t, "01", msg.GetFieldOrNil("reader"))
+	assert.Equal(t, "ABCD1234", msg.GetFieldOrNil("card"))
+	assert.Equal(t, "@01:ABCD1234\r\n", msg.GetFramesStr())
+
+	_, err = decoder.Decode(FramePacket("hello"))
+	assert.Error(t, err)
+
+	_, err = NewRegexTextDecoder(`(?P<bad`)
+	assert.Error(t, err)
+}
+
+func TestTemplateTextEncoder(t *testing.T) {
+	encoder, err := NewTemplateTextEncoder("OPEN={{.door}};DELAY={{.delay}}\r\n")
+	assert.NoError(t, err)
+	frame, err := encoder.Encode(NewMessagePacketFields(map[string]interface{}{
+		"door":  2,
+		"delay": "3s",
+	}))
+	assert.NoError(t, err)
+	assert.Equal(t, "OPEN=2;DELAY=3s\r\n", string(frame))
+
+	_, err = NewTemplateTextEncoder("{{.door")
+	assert.Error(t, err)
+}
+
+func TestTextCodecComponents(t *testing.T) {
+	_, factory := CSVTextDecoderFactory()
+	csvDecoder := factory().(*CSVTextDecoder)
+	csvDecoder.OnInit(map[string]interface{}{"columns": []interface{}{"card", "door"}, "separator": ";"}, nil)
+	msg, err := csvDecoder.Decode(FramePacket("12345;2\n"))
+	assert.NoError(t, err)
+	assert.Equal(t, "12345", msg.GetFieldOrNil("card"))
+	assert.Equal(t, "2", msg.GetFieldOrNil("door"))
+
+	_, factory = CSVTextEncoderFactory()
+	csvEncoder := factory().(*CSVTextEncoder)
+	csvEncoder.OnInit(map[string]interface{}{"columns": []interface{}{"door", "card"}}, nil)
+	frame, err := csvEncoder.Encode(msg)
+	assert.NoError(t, err)
+	assert.Equal(t, "2,12345\r\n", string(frame))
+
+	_, factory = RegexTextDecoderFactory()
+	regexDecoder := factory().(*RegexTextDecoder)
+	regexDecoder.OnInit(map[string]interface{}{"pattern": `^CARD:(?P<card>\d+)$`}, nil)
+	msg, err = regexDecoder.Decode(FramePacket("CARD:12345"))
+	assert.NoError(t, err)
+	assert.Equal(t, "12345", msg.GetFieldOrNil("card"))
+
+	_, factory = TemplateTextEncoderFactory()
+	templateEncoder := factory().(*TemplateTextEncoder)
+	templateEncoder.OnInit(map[string]interface{}{"template": "C={{.card}}"}, nil)
+	frame, err = templateEncoder.Encode(msg)
+	assert.NoError(t, err)
+	assert.Equal(t, "C=12345", string(frame))
+
+	// 未初始化时返回错误
+	_, err = new(CSVTextDecoder).Decode(FramePacket("12345;2"))
+	assert.Error(t, err)
+
+	// 缺少或错误的配置项
+	assert.Panics(t, func() { new(CSVTextDecoder).OnInit(map[string]interface{}{}, nil) })
+	assert.Panics(t, func() {
+		new(CSVTextEncoder).OnInit(map[string]interface{}{"columns": []interface{}{"a"}, "separator": ";;"}, nil)
+	})
+	assert.Panics(t, func() { new(RegexTextDecoder).OnInit(map[string]interface{}{"pattern": "("}, nil) })
+	assert.Panics(t, func() { new(TemplateTextEncoder).OnInit(map[string]interface{}{}, nil) })
+}
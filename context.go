@@ -4,6 +4,7 @@ import (
 	"container/list"
 	"github.com/yoojia/go-gecko/v2/utils"
 	"github.com/yoojia/go-value"
+	"sync"
 	"time"
 )
 
@@ -27,6 +28,9 @@ type Context interface {
 	// 获取Interceptor设备列表，返回一个复制列表
 	GetInterceptors() *list.List
 
+	// 获取OutboundInterceptor列表，返回一个复制列表
+	GetOutboundInterceptors() *list.List
+
 	// 获取Driver列表，返回一个复制列表
 	GetDrivers() *list.List
 
@@ -65,6 +69,12 @@ type Context interface {
 	// 读取Context的KeyValue数据
 	GetScoped(key interface{}) interface{}
 
+	// 返回共享的状态存储
+	StateStore() StateStore
+
+	// 返回内部事件发布接口
+	Publisher() Publisher
+
 	////
 
 	// 返回Gecko的配置
@@ -82,15 +92,23 @@ type _GeckoContext struct {
 	cfgGeckos           map[string]interface{}
 	cfgGlobals          map[string]interface{}
 	cfgInterceptors     map[string]interface{}
+	cfgOutbounds        map[string]interface{}
 	cfgDrivers          map[string]interface{}
 	cfgTriggers         map[string]interface{}
 	cfgOutputs          map[string]interface{}
 	cfgInputs           map[string]interface{}
 	cfgLogics           map[string]interface{}
 	cfgPlugins          map[string]interface{}
+	cfgSchemas          map[string]interface{}
+	cfgRoutes           map[string]interface{}
+	cfgCodecs           map[string]interface{}
 	scopedKV            map[interface{}]interface{}
+	scopedMu            sync.RWMutex
+	stateStore          StateStore
+	publisher           Publisher
 	plugins             *list.List
 	interceptors        *list.List
+	outbounds           *list.List
 	drivers             *list.List
 	triggers            *list.List
 	outputs             *list.List
@@ -135,6 +153,11 @@ func (c *_GeckoContext) GetInterceptors() *list.List {
 	return copyList(c.interceptors)
 }
 
+// 获取OutboundInterceptor列表
+func (c *_GeckoContext) GetOutboundInterceptors() *list.List {
+	return copyList(c.outbounds)
+}
+
 // 获取Driver列表
 func (c *_GeckoContext) GetDrivers() *list.List {
 	return copyList(c.drivers)
@@ -151,6 +174,8 @@ func (c *_GeckoContext) GetPlugins() *list.List {
 }
 
 func (c *_GeckoContext) PutScoped(key interface{}, value interface{}) {
+	c.scopedMu.Lock()
+	defer c.scopedMu.Unlock()
 	if _, ok := c.scopedKV[key]; ok {
 		log.Panicw("ScopedKey 不可重复，Key已存在", "key", key)
 	}
@@ -158,9 +183,19 @@ func (c *_GeckoContext) PutScoped(key interface{}, value interface{}) {
 }
 
 func (c *_GeckoContext) GetScoped(key interface{}) interface{} {
+	c.scopedMu.RLock()
+	defer c.scopedMu.RUnlock()
 	return c.scopedKV[key]
 }
 
+func (c *_GeckoContext) StateStore() StateStore {
+	return c.stateStore
+}
+
+func (c *_GeckoContext) Publisher() Publisher {
+	return c.publisher
+}
+
 func (c *_GeckoContext) CheckTimeout(msg string, timeout time.Duration, action func()) {
 	t := time.AfterFunc(timeout, func() {
 		log.Warnf("指令执行时间太长", "action", msg, "timeout", timeout.String())
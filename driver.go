@@ -10,6 +10,9 @@ package gecko
 type Driver interface {
 	NeedTopicFilter
 	NeedName
+	// Driver可设置优先级，多个Driver匹配同一Topic时，优先级高的Driver优先处理
+	GetPriority() int
+	setPriority(p int)
 	// 处理外部请求，返回响应结果。
 	// 在Driver内部，可以通过 OutputDeliverer 来控制其它设备。
 	Drive(attrs Attributes, topic string, uuid string, in *MessagePacket, fn OutputDeliverer, ctx Context) (out *MessagePacket, err error)
@@ -19,8 +22,10 @@ type Driver interface {
 
 type AbcDriver struct {
 	Driver
-	name   string
-	topics []*TopicExpr
+	name     string
+	priority int
+	topics   []*TopicExpr
+	where    *WhereExpr
 }
 
 func (ad *AbcDriver) setName(name string) {
@@ -32,6 +37,14 @@ func (ad *AbcDriver) GetName() string {
 	return ad.name
 }
 
+func (ad *AbcDriver) GetPriority() int {
+	return ad.priority
+}
+
+func (ad *AbcDriver) setPriority(priority int) {
+	ad.priority = priority
+}
+
 func (ad *AbcDriver) setTopics(topics []string) {
 	for _, t := range topics {
 		ad.topics = append(ad.topics, newTopicExpr(t))
@@ -43,8 +56,106 @@ func (ad *AbcDriver) GetTopicExpr() []*TopicExpr {
 	return ad.topics
 }
 
+func (ad *AbcDriver) setWhere(where *WhereExpr) {
+	ad.where = where
+}
+
+// 获取消息内容过滤表达式
+func (ad *AbcDriver) GetWhereExpr() *WhereExpr {
+	return ad.where
+}
+
 func NewAbcDriver() *AbcDriver {
 	return &AbcDriver{
 		topics: make([]*TopicExpr, 0),
 	}
 }
+
+////
+
+// Driver调度策略，在[GECKO]配置项 driverStrategy 中设置
+const (
+	// 每个Topic只允许一个Driver处理，多个Driver匹配同一个InputDevice的Topic时启动失败。默认策略。
+	DriverStrategyExclusive = "exclusive"
+	// 多个Driver匹配时，按优先级选择第一个满足条件的Driver处理
+	DriverStrategyPriority = "priority"
+	// 多个Driver匹配时，全部并发处理，返回数据由[GECKO]配置项 driverMerge 指定的合并函数合并
+	DriverStrategyAggregate = "aggregate"
+)
+
+// 内置的Driver返回数据合并函数名称
+const (
+	// 合并全部返回数据的字段，字段相同时优先级高的Driver优先。默认合并函数。
+	DriverMergeFields = "fields"
+	// 使用第一个处理成功的Driver的返回数据
+	DriverMergeFirst = "first"
+	// 以Driver名称为Key，保存每个Driver的返回数据字段
+	DriverMergeNamed = "named"
+)
+
+// 聚合模式下单个Driver的处理结果
+type DriverResult struct {
+	Name     string
+	Outbound *MessagePacket
+	Err      error
+}
+
+// 聚合模式下合并多个Driver返回数据的函数。results按Driver优先级排序。
+type DriverMergeFunc func(results []DriverResult) *MessagePacket
+
+func mergeDriverFields(results []DriverResult) *MessagePacket {
+	out := NewMessagePacket()
+	// 按优先级从低到高写入，优先级高的字段覆盖优先级低的字段
+	for i := len(results) - 1; i >= 0; i-- {
+		if r := results[i]; nil == r.Err && nil != r.Outbound {
+			r.Outbound.RangeFields(out.AddField)
+			if frames := r.Outbound.GetFrames(); len(frames) > 0 {
+				out.SetFrames(frames)
+			}
+		}
+	}
+	return withDriverErrors(out, results)
+}
+
+func mergeDriverFirst(results []DriverResult) *MessagePacket {
+	for _, r := range results {
+		if nil == r.Err && nil != r.Outbound {
+			return r.Outbound
+		}
+	}
+	return withDriverErrors(NewMessagePacket(), results)
+}
+
+func mergeDriverNamed(results []DriverResult) *MessagePacket {
+	out := NewMessagePacket()
+	for _, r := range results {
+		if nil != r.Err {
+			out.AddField(r.Name, map[string]interface{}{"error": r.Err.Error()})
+		} else if nil != r.Outbound {
+			out.AddField(r.Name, r.Outbound.GetFields())
+		}
+	}
+	return out
+}
+
+// 将处理失败的Driver错误信息添加到 errors 字段；全部Driver处理失败时，同时设置 error 字段。
+func withDriverErrors(out *MessagePacket, results []DriverResult) *MessagePacket {
+	errs := make(map[string]interface{})
+	var first error
+	for _, r := range results {
+		if nil != r.Err {
+			errs[r.Name] = r.Err.Error()
+			if nil == first {
+				first = r.Err
+			}
+		}
+	}
+	if 0 == len(errs) {
+		return out
+	}
+	out.AddField("errors", errs)
+	if len(errs) == len(results) {
+		out.AddField("error", first.Error())
+	}
+	return out
+}
@@ -12,4 +12,5 @@ require (
 	go.uber.org/multierr v1.1.0 // indirect
 	go.uber.org/zap v1.9.1
 	golang.org/x/sys v0.0.0-20190419153524-e8e3143a4f4a // indirect
+	gopkg.in/yaml.v2 v2.4.0
 )
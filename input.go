@@ -18,6 +18,15 @@ func (fn InputDeliverer) Deliver(topic string, rawFrame FramePacket) (encodedFra
 	return fn(topic, rawFrame)
 }
 
+// Input设备的事件投递模式，在Input设备配置项 mode 中设置
+const (
+	// 请求-响应模式：等待Driver处理结果，并由Encoder编码后返回给Input设备。默认模式。
+	InputModeRequest = "request"
+	// 单向模式：事件进入处理队列后立即返回，只执行Interceptor和Trigger，不执行Driver，不调用Encoder。
+	// 适用于只上报数据、不需要响应的传感器等设备。
+	InputModeOneway = "oneway"
+)
+
 // Input设备是表示向系统输入数据的设备
 type InputDevice interface {
 	VirtualDevice
@@ -25,6 +34,9 @@ type InputDevice interface {
 	// 输入设备都具有一个Topic
 	setTopic(topic string)
 	GetTopic() string
+	// 事件投递模式
+	setMode(mode string)
+	GetMode() string
 	// 逻辑设备
 	addLogic(device LogicDevice) error
 	GetLogicList() []LogicDevice
@@ -43,6 +55,7 @@ type AbcInputDevice struct {
 	decoder    Decoder
 	encoder    Encoder
 	topic      string
+	mode       string
 	namedLogic map[string]LogicDevice
 }
 
@@ -54,6 +67,18 @@ func (d *AbcInputDevice) GetTopic() string {
 	return d.topic
 }
 
+func (d *AbcInputDevice) setMode(mode string) {
+	d.mode = mode
+}
+
+// 返回事件投递模式，未设置时为 InputModeRequest
+func (d *AbcInputDevice) GetMode() string {
+	if "" == d.mode {
+		return InputModeRequest
+	}
+	return d.mode
+}
+
 func (d *AbcInputDevice) setDecoder(decoder Decoder) {
 	d.decoder = decoder
 }
@@ -8,6 +8,30 @@ import "errors"
 
 var ErrInterceptorDropped = errors.New("INTERCEPTOR_DROPPED")
 
+// Interceptor返回普通错误时的处理策略，通过配置项 onError 设置
+const (
+	// 记录错误并继续执行后续拦截器（默认）
+	InterceptorOnErrorContinue = "continue"
+	// 中断事件，并响应错误信息
+	InterceptorOnErrorAbort = "abort"
+)
+
+// Interceptor处理结果写入Session属性的Key
+const (
+	// 中断事件的拦截器名称
+	InterceptorDroppedAttrKey = "@Interceptor.DROPPED"
+	// 中断事件的原因代码
+	InterceptorReasonAttrKey = "@Interceptor.REASON"
+	// 直接响应事件的拦截器名称
+	InterceptorRepliedAttrKey = "@Interceptor.REPLIED"
+	// 替换了Inbound消息的拦截器名称列表，按执行顺序排列
+	InterceptorReplacedAttrKey = "@Interceptor.REPLACED"
+	// 拦截器返回的错误信息，Key为拦截器名称
+	InterceptorErrorsAttrKey = "@Interceptor.ERRORS"
+	// 因错误而中断事件的拦截器名称
+	InterceptorAbortedAttrKey = "@Interceptor.ABORTED"
+)
+
 // Interceptor事件拦截器
 // 在Gecko系统中，通过Trigger触发事件后，由 Interceptor 处理拦截。
 // 负责对触发器发起的事件进行拦截处理，不符合规则的事件将被中断，丢弃。
@@ -17,7 +41,15 @@ type Interceptor interface {
 	// Interceptor可设置优先级
 	GetPriority() int
 	setPriority(p int)
-	// 拦截处理过程。抛出 {@link ErrInterceptorDropped} 来中断拦截。
+	// 返回普通错误时的处理策略：continue / abort
+	GetErrorPolicy() string
+	setErrorPolicy(policy string)
+	// 拦截处理过程。返回值：
+	// 1. nil：继续处理；
+	// 2. {@link ErrInterceptorDropped} 或 DropWith()：中断事件；
+	// 3. Reply()：使用自定义消息响应并中断事件；
+	// 4. Replace()：替换Inbound消息并继续处理；
+	// 5. 其它错误：按 onError 策略记录错误后继续，或者中断事件。
 	Handle(attrs Attributes, topic string, uuid string, in *MessagePacket, ctx Context) error
 }
 
@@ -26,7 +58,9 @@ type AbcInterceptor struct {
 	Interceptor
 	name     string
 	priority int
+	onError  string
 	topics   []*TopicExpr
+	where    *WhereExpr
 }
 
 func (ai *AbcInterceptor) setName(name string) {
@@ -45,6 +79,17 @@ func (ai *AbcInterceptor) setPriority(priority int) {
 	ai.priority = priority
 }
 
+func (ai *AbcInterceptor) GetErrorPolicy() string {
+	if "" == ai.onError {
+		return InterceptorOnErrorContinue
+	}
+	return ai.onError
+}
+
+func (ai *AbcInterceptor) setErrorPolicy(policy string) {
+	ai.onError = policy
+}
+
 func (ai *AbcInterceptor) setTopics(topics []string) {
 	for _, t := range topics {
 		ai.topics = append(ai.topics, newTopicExpr(t))
@@ -60,11 +105,41 @@ func (ai *AbcInterceptor) Drop() error {
 	return InterceptedDropError()
 }
 
+// Interceptor发起Drop操作，并附带原因代码
+func (ai *AbcInterceptor) DropWith(reason string) error {
+	return &InterceptedResult{action: interceptActionDrop, reason: reason}
+}
+
+// Interceptor使用自定义消息响应，并中断后续处理
+func (ai *AbcInterceptor) Reply(out *MessagePacket) error {
+	if nil == out {
+		out = NewMessagePacket()
+	}
+	return &InterceptedResult{action: interceptActionReply, packet: out}
+}
+
+// Interceptor替换Inbound消息，后续的拦截器、Driver和Trigger将处理新的消息
+func (ai *AbcInterceptor) Replace(in *MessagePacket) error {
+	if nil == in {
+		in = NewMessagePacket()
+	}
+	return &InterceptedResult{action: interceptActionReplace, packet: in}
+}
+
 // Interceptor允许继续处理
 func (ai *AbcInterceptor) Next() error {
 	return nil
 }
 
+func (ai *AbcInterceptor) setWhere(where *WhereExpr) {
+	ai.where = where
+}
+
+// 获取消息内容过滤表达式
+func (ai *AbcInterceptor) GetWhereExpr() *WhereExpr {
+	return ai.where
+}
+
 func NewAbcInterceptor() *AbcInterceptor {
 	return &AbcInterceptor{
 		topics: make([]*TopicExpr, 0),
@@ -76,6 +151,55 @@ func InterceptedDropError() error {
 	return ErrInterceptorDropped
 }
 
+const (
+	interceptActionDrop = iota
+	interceptActionReply
+	interceptActionReplace
+)
+
+// Interceptor的处理指令，由 AbcInterceptor 的 DropWith / Reply / Replace 创建
+type InterceptedResult struct {
+	action int
+	reason string
+	packet *MessagePacket
+}
+
+func (r *InterceptedResult) Error() string {
+	switch r.action {
+	case interceptActionReply:
+		return "INTERCEPTOR_REPLIED"
+	case interceptActionReplace:
+		return "INTERCEPTOR_REPLACED"
+	}
+	if "" == r.reason {
+		return ErrInterceptorDropped.Error()
+	}
+	return ErrInterceptorDropped.Error() + ": " + r.reason
+}
+
+// 返回中断事件的原因代码
+func (r *InterceptedResult) Reason() string {
+	return r.reason
+}
+
+// 判断拦截器返回的错误是否为中断事件，包括 ErrInterceptorDropped 和 DropWith() 的返回值
+func IsInterceptorDropped(err error) bool {
+	if ErrInterceptorDropped == err {
+		return true
+	}
+	r, ok := err.(*InterceptedResult)
+	return ok && interceptActionDrop == r.action
+}
+
+// 检查onError配置项是否有效
+func isInterceptorErrorPolicy(policy string) bool {
+	switch policy {
+	case InterceptorOnErrorContinue, InterceptorOnErrorAbort:
+		return true
+	}
+	return false
+}
+
 ////
 
 // 拦截器排序
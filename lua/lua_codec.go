@@ -0,0 +1,113 @@
+package lua
+
+import (
+	"errors"
+	"github.com/yoojia/go-gecko/v2"
+	"github.com/yoojia/go-value"
+	"github.com/yuin/gopher-lua"
+)
+
+//
+// Author: 陈哈哈 chenyongjia@parkingwang.com, yoojiachen@gmail.com
+//
+
+func ScriptDecoderFactory() (string, gecko.Factory) {
+	return "ScriptDecoder", func() interface{} {
+		return new(ScriptDecoder)
+	}
+}
+
+func ScriptEncoderFactory() (string, gecko.Factory) {
+	return "ScriptEncoder", func() interface{} {
+		return new(ScriptEncoder)
+	}
+}
+
+// 脚本编解码器的公共部分
+type scriptCodec struct {
+	scriptFile string
+	poolConfig lStatePoolConfig
+	pool       *lStatePool
+}
+
+func (c *scriptCodec) OnInit(args map[string]interface{}, ctx gecko.Context) {
+	c.scriptFile = value.Of(args["script"]).String()
+	if "" == c.scriptFile {
+		log.Panic("参数[script]是必须的")
+	}
+	c.poolConfig = lStatePoolConfigOf(args, ctx)
+}
+
+func (c *scriptCodec) OnStart(ctx gecko.Context) {
+	pool, err := newLStatePool(c.scriptFile, c.poolConfig)
+	if nil != err {
+		log.Panic(err)
+	}
+	c.pool = pool
+}
+
+func (c *scriptCodec) OnStop(ctx gecko.Context) {
+	c.pool.close()
+}
+
+// Lua脚本解码器，通过外置Lua脚本的 decodeMain 函数，将字节数据解码成MessagePacket。
+// 如果脚本返回的Table不包含frames字段，原始字节数据保存在MessagePacket.Frames字段。
+type ScriptDecoder struct {
+	scriptCodec
+}
+
+func (d *ScriptDecoder) Decode(frames gecko.FramePacket) (*gecko.MessagePacket, error) {
+	L, err := d.pool.get()
+	if nil != err {
+		return nil, err
+	}
+	defer d.pool.put(L)
+	// Lua的函数原型： function decodeMain(frameBytes) (table, error)
+	L.Push(L.GetGlobal("decodeMain"))
+	L.Push(lua.LString(string(frames)))
+	if err := d.pool.call(L, 1, 2); err != nil {
+		log.Error("Lua.decoder脚本发生错误("+d.scriptFile+"): ", err)
+		return nil, err
+	}
+	retData := L.ToTable(1)
+	retErr := L.ToString(2)
+	L.Pop(2)
+	if "" != retErr {
+		return nil, errors.New("LuaScript返回错误：" + retErr)
+	}
+	msg, err := lTableToMessage(retData)
+	if nil != err {
+		return nil, err
+	}
+	if nil == msg.GetFrames() {
+		msg.SetFrames(frames)
+	}
+	return msg, nil
+}
+
+// Lua脚本编码器，通过外置Lua脚本的 encodeMain 函数，将MessagePacket编码成字节数据。
+type ScriptEncoder struct {
+	scriptCodec
+}
+
+func (e *ScriptEncoder) Encode(data *gecko.MessagePacket) (gecko.FramePacket, error) {
+	L, err := e.pool.get()
+	if nil != err {
+		return nil, err
+	}
+	defer e.pool.put(L)
+	// Lua的函数原型： function encodeMain(fieldsTable) (frameBytes, error)
+	L.Push(L.GetGlobal("encodeMain"))
+	L.Push(messageToLTable(data))
+	if err := e.pool.call(L, 1, 2); err != nil {
+		log.Error("Lua.encoder脚本发生错误("+e.scriptFile+"): ", err)
+		return nil, err
+	}
+	ret := L.ToString(1)
+	retErr := L.ToString(2)
+	L.Pop(2)
+	if "" != retErr {
+		return nil, errors.New("LuaScript返回错误：" + retErr)
+	}
+	return gecko.FramePacket(ret), nil
+}
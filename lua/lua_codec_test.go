@@ -0,0 +1,42 @@
+package lua
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/yoojia/go-gecko/v2"
+	"sync"
+	"testing"
+)
+
+func TestScriptCodecConcurrent(t *testing.T) {
+	args := map[string]interface{}{
+		"script":   "../cmd/scripts/codec-sample.lua",
+		"poolSize": 2,
+	}
+	decoder := new(ScriptDecoder)
+	decoder.OnInit(args, nil)
+	decoder.OnStart(nil)
+	defer decoder.OnStop(nil)
+	encoder := new(ScriptEncoder)
+	encoder.OnInit(args, nil)
+	encoder.OnStart(nil)
+	defer encoder.OnStop(nil)
+
+	wg := new(sync.WaitGroup)
+	for i := 0; i < 32; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			frame := gecko.FramePacket(fmt.Sprintf("CARD=%d;DOOR=2\r\n", i))
+			msg, err := decoder.Decode(frame)
+			assert.NoError(t, err)
+			assert.Equal(t, fmt.Sprintf("%d", i), msg.GetFieldOrNil("CARD"))
+			assert.Equal(t, []byte(frame), msg.GetFrames())
+
+			out, err := encoder.Encode(msg)
+			assert.NoError(t, err)
+			assert.Equal(t, string(frame), string(out))
+		}(i)
+	}
+	wg.Wait()
+}
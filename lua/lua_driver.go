@@ -4,7 +4,6 @@ import (
 	"errors"
 	"github.com/yoojia/go-gecko/v2"
 	"github.com/yoojia/go-value"
-	"github.com/yuin/gopher-lua"
 )
 
 //
@@ -24,11 +23,13 @@ func NewScriptDriver() *ScriptDriver {
 }
 
 // Lua脚本驱动，
+// Pipeline会在多个协程中并发调用Drive函数，每个调用从LState池中独占一个已加载脚本的LState。
 type ScriptDriver struct {
 	*gecko.AbcDriver
 	gecko.LifeCycle
 	scriptFile string
-	L          *lua.LState
+	poolConfig lStatePoolConfig
+	pool       *lStatePool
 	args       map[string]interface{}
 }
 
@@ -38,37 +39,44 @@ func (d *ScriptDriver) OnInit(args map[string]interface{}, ctx gecko.Context) {
 	if "" == d.scriptFile {
 		log.Panic("参数[script]是必须的")
 	}
+	d.poolConfig = lStatePoolConfigOf(args, ctx)
 }
 
 func (d *ScriptDriver) OnStart(ctx gecko.Context) {
-	d.L = NewLuaEngine()
-	if err := d.L.DoFile(d.scriptFile); nil != err {
-		log.Panicf("加载LUA脚本出错("+d.scriptFile+"): ", err)
+	pool, err := newLStatePool(d.scriptFile, d.poolConfig)
+	if nil != err {
+		log.Panic(err)
 	}
+	d.pool = pool
 }
 
 func (d *ScriptDriver) OnStop(ctx gecko.Context) {
-	d.L.Close()
+	d.pool.close()
 }
 
 func (d *ScriptDriver) Drive(attrs gecko.Attributes, topic string, uuid string, in *gecko.MessagePacket,
 	deliverer gecko.OutputDeliverer, ctx gecko.Context) (out *gecko.MessagePacket, err error) {
+	L, err := d.pool.get()
+	if nil != err {
+		return nil, err
+	}
+	defer d.pool.put(L)
 	// Lua的函数原型： function driverMain(inbounds, deliverFn) (response, error)
-	nArgs := setupDeliLuaFn(d.L, d.args, "driverMain", attrs, topic, uuid, in, deliverer)
+	nArgs := setupDeliLuaFn(L, d.args, "driverMain", attrs, topic, uuid, in, deliverer)
 	// 2 - Lua定义的入口main函数-返回值数量
-	if err := d.L.PCall(nArgs, 2, nil); err != nil {
+	if err := d.pool.call(L, nArgs, 2); err != nil {
 		log.Error("Lua.driver脚本发生错误("+d.scriptFile+"): ", err)
 		return nil, err
 	}
 
 	// 函数调用后，参数和函数全部出栈，此时栈中为函数返回值。
-	retData := d.L.ToTable(1)
-	retErr := d.L.ToString(2)
-	d.L.Pop(2) // remove received
+	retData := L.ToTable(1)
+	retErr := L.ToString(2)
+	L.Pop(2) // remove received
 
 	if "" != retErr {
 		return nil, errors.New("LuaScript返回错误：" + retErr)
 	} else {
-		return lTableToMessage(retData), nil
+		return lTableToMessage(retData)
 	}
 }
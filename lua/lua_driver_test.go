@@ -0,0 +1,71 @@
+package lua
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/yoojia/go-gecko/v2"
+	"io/ioutil"
+	"os"
+	"sync"
+	"testing"
+)
+
+const testDriverScript = `
+function driverMain(args, request, deliverFn)
+    local ret, err = deliverFn(args["targetUuid"], { seq = request.inbound.seq })
+    if err ~= nil then
+        return nil, err
+    end
+    return { seq = ret.seq, topic = request.topic }, nil
+end
+`
+
+func writeTestScript(t *testing.T, script string) string {
+	f, err := ioutil.TempFile("", "gecko-*.lua")
+	assert.NoError(t, err)
+	_, err = f.WriteString(script)
+	assert.NoError(t, err)
+	assert.NoError(t, f.Close())
+	return f.Name()
+}
+
+func TestScriptDriverConcurrentDrive(t *testing.T) {
+	script := writeTestScript(t, testDriverScript)
+	defer os.Remove(script)
+
+	driver := NewScriptDriver()
+	driver.OnInit(map[string]interface{}{
+		"script":      script,
+		"targetUuid":  "OUTPUT",
+		"poolMinSize": int64(2),
+		"poolMaxSize": int64(4),
+	}, nil)
+	driver.OnStart(nil)
+	defer driver.OnStop(nil)
+
+	deliverer := gecko.OutputDeliverer(func(uuid string, msg *gecko.MessagePacket) (*gecko.MessagePacket, error) {
+		assert.Equal(t, "OUTPUT", uuid)
+		return msg, nil
+	})
+	wg := new(sync.WaitGroup)
+	for i := 0; i < 64; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			attrs := &testAttrs{data: make(map[string]interface{})}
+			topic := fmt.Sprintf("/door/%d", i)
+			in := gecko.NewMessagePacketFields(map[string]interface{}{"seq": int64(i)})
+			for n := 0; n < 20; n++ {
+				out, err := driver.Drive(attrs, topic, "uuid", in, deliverer, nil)
+				assert.NoError(t, err)
+				assert.Equal(t, float64(i), out.GetFieldOrNil("seq"))
+				assert.Equal(t, topic, out.GetFieldOrNil("topic"))
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	total, idle := driver.pool.stats()
+	assert.True(t, total <= 4)
+	assert.Equal(t, total, idle)
+}
@@ -0,0 +1,110 @@
+package lua
+
+import (
+	"context"
+	"errors"
+	"github.com/yoojia/go-gecko/v2"
+	"github.com/yoojia/go-value"
+	"github.com/yuin/gopher-lua"
+	"time"
+)
+
+//
+// Author: 陈哈哈 chenyongjia@parkingwang.com, yoojiachen@gmail.com
+//
+
+func ScriptInputDeviceFactory() (string, gecko.Factory) {
+	return "ScriptInputDevice", func() interface{} {
+		return NewScriptInputDevice()
+	}
+}
+
+func NewScriptInputDevice() *ScriptInputDevice {
+	return &ScriptInputDevice{
+		AbcInputDevice: gecko.NewAbcInputDevice(),
+	}
+}
+
+// Lua脚本输入设备，在独立的LState中运行外置Lua脚本的 serveMain 函数。
+// 脚本可以通过 deliverFn 发起输入事件，例如轮询本地文件、定时产生数据帧等。
+// 脚本中可以调用 sleep(ms) 函数等待；设备停止时，正在运行的脚本被中断。
+// serveMain 是长期运行的函数，sandbox 参数中的 timeout 对它无效。
+type ScriptInputDevice struct {
+	*gecko.AbcInputDevice
+	scriptFile string
+	sandbox    *Sandbox
+	L          *lua.LState
+	args       map[string]interface{}
+	stopCtx    context.Context
+	stopFunc   context.CancelFunc
+}
+
+func (d *ScriptInputDevice) OnInit(args map[string]interface{}, ctx gecko.Context) {
+	d.args = args
+	d.scriptFile = value.Of(args["script"]).String()
+	if "" == d.scriptFile {
+		log.Panic("参数[script]是必须的")
+	}
+	sandbox, err := sandboxOf(args)
+	if nil != err {
+		log.Panicw("脚本配置项[sandbox]错误", "error", err)
+	}
+	d.sandbox = sandbox
+}
+
+func (d *ScriptInputDevice) OnStart(ctx gecko.Context) {
+	d.L = newSandboxEngine(d.sandbox)
+	preloadGecko(d.L, ctx)
+	if err := d.L.DoFile(d.scriptFile); nil != err {
+		log.Panicw("加载LUA脚本出错", "script", d.scriptFile, "error", err)
+	}
+	d.stopCtx, d.stopFunc = context.WithCancel(context.Background())
+	d.L.SetGlobal("sleep", d.L.NewFunction(func(l *lua.LState) int {
+		select {
+		case <-time.After(time.Duration(l.CheckInt64(1)) * time.Millisecond):
+		case <-d.stopCtx.Done():
+		}
+		return 0
+	}))
+}
+
+func (d *ScriptInputDevice) OnStop(ctx gecko.Context) {
+	d.stopFunc()
+}
+
+func (d *ScriptInputDevice) Serve(ctx gecko.Context, deliverer gecko.InputDeliverer) error {
+	defer d.L.Close()
+	d.L.SetContext(d.stopCtx)
+	// Lua的函数原型： function serveMain(args, deliverFn) error
+	d.L.Push(d.L.GetGlobal("serveMain"))
+	d.L.Push(mapToLTable(d.args))
+	d.L.Push(d.L.NewFunction(func(l *lua.LState) int {
+		// 原型为： function deliver(frames [, topic]) (frames, error)
+		frames := l.CheckString(1)
+		topic := l.OptString(2, d.GetTopic())
+		if ret, err := deliverer.Deliver(topic, gecko.FramePacket(frames)); nil != err {
+			log.Error("Go.deliver发生错误@serveMain: ", err)
+			l.Push(lua.LNil)
+			l.Push(lua.LString(err.Error()))
+		} else {
+			l.Push(lua.LString(string(ret)))
+			l.Push(lua.LNil)
+		}
+		return 2
+	}))
+	if err := d.L.PCall(2, 1, nil); err != nil {
+		if nil != d.stopCtx.Err() {
+			// 设备停止，中断脚本运行
+			return nil
+		}
+		log.Error("Lua.input脚本发生错误("+d.scriptFile+"): ", err)
+		return err
+	}
+	retErr := d.L.ToString(1)
+	d.L.Pop(1)
+	if "" != retErr {
+		return errors.New("LuaScript返回错误：" + retErr)
+	} else {
+		return nil
+	}
+}
@@ -0,0 +1,36 @@
+package lua
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/yoojia/go-gecko/v2"
+	"testing"
+	"time"
+)
+
+func TestScriptInputDeviceServeAndStop(t *testing.T) {
+	input := NewScriptInputDevice()
+	input.OnInit(map[string]interface{}{
+		"script":   "../cmd/scripts/input-sample.lua",
+		"periodMs": int64(10),
+	}, nil)
+	input.OnStart(nil)
+
+	frames := make(chan string, 64)
+	done := make(chan error, 1)
+	go func() {
+		done <- input.Serve(nil, func(topic string, frame gecko.FramePacket) (gecko.FramePacket, error) {
+			frames <- string(frame)
+			return gecko.FramePacket(`{"status":"ok"}`), nil
+		})
+	}()
+	assert.Equal(t, `{"seq": 1}`, <-frames)
+	assert.Equal(t, `{"seq": 2}`, <-frames)
+
+	input.OnStop(nil)
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("ScriptInputDevice did not stop")
+	}
+}
@@ -0,0 +1,140 @@
+package lua
+
+import (
+	"errors"
+	"github.com/yoojia/go-gecko/v2"
+	"github.com/yoojia/go-value"
+	"github.com/yuin/gopher-lua"
+)
+
+//
+// Author: 陈哈哈 chenyongjia@parkingwang.com, yoojiachen@gmail.com
+//
+
+const (
+	// 脚本返回值：继续处理
+	InterceptNext = "next"
+	// 脚本返回值：中断事件
+	InterceptDrop = "drop"
+	// 脚本返回值：使用自定义消息响应并中断事件
+	InterceptReply = "reply"
+)
+
+func ScriptInterceptorFactory() (string, gecko.Factory) {
+	return "ScriptInterceptor", func() interface{} {
+		return NewScriptInterceptor()
+	}
+}
+
+func NewScriptInterceptor() *ScriptInterceptor {
+	return &ScriptInterceptor{
+		AbcInterceptor: gecko.NewAbcInterceptor(),
+	}
+}
+
+// Lua脚本拦截器，通过外置Lua脚本的 interceptMain 函数，实现按站点变化的访问规则（时间窗口、黑名单等）。
+// 与其它Interceptor一样，通过配置项 priority 和 topics 设置优先级和Topic过滤。
+type ScriptInterceptor struct {
+	*gecko.AbcInterceptor
+	scriptFile string
+	poolConfig lStatePoolConfig
+	pool       *lStatePool
+	args       map[string]interface{}
+}
+
+func (si *ScriptInterceptor) OnInit(args map[string]interface{}, ctx gecko.Context) {
+	si.args = args
+	si.scriptFile = value.Of(args["script"]).String()
+	if "" == si.scriptFile {
+		log.Panic("参数[script]是必须的")
+	}
+	si.poolConfig = lStatePoolConfigOf(args, ctx)
+}
+
+func (si *ScriptInterceptor) OnStart(ctx gecko.Context) {
+	pool, err := newLStatePool(si.scriptFile, si.poolConfig)
+	if nil != err {
+		log.Panic(err)
+	}
+	si.pool = pool
+}
+
+func (si *ScriptInterceptor) OnStop(ctx gecko.Context) {
+	si.pool.close()
+}
+
+func (si *ScriptInterceptor) Handle(attrs gecko.Attributes, topic string, uuid string, in *gecko.MessagePacket, ctx gecko.Context) error {
+	L, err := si.pool.get()
+	if nil != err {
+		return err
+	}
+	defer si.pool.put(L)
+	// Lua的函数原型： function interceptMain(args, request) (result, attrs)
+	// 其中 result 为 "next" / "drop" / 错误信息，或者处理指令Table；attrs 为需要添加到Session属性的Table，可为nil。
+	L.Push(L.GetGlobal("interceptMain"))
+	L.Push(mapToLTable(si.args))
+	L.Push(newRequestTable(L, attrs, topic, uuid, in))
+	if err := si.pool.call(L, 2, 2); err != nil {
+		log.Error("Lua.interceptor脚本发生错误("+si.scriptFile+"): ", err)
+		return err
+	}
+	result := L.Get(1)
+	if table, ok := L.Get(2).(*lua.LTable); ok {
+		values, err := lTableToMap(table)
+		if nil != err {
+			L.Pop(2)
+			return err
+		}
+		for k, v := range values {
+			attrs.Add(k, v)
+		}
+	}
+	L.Pop(2)
+
+	if table, ok := result.(*lua.LTable); ok {
+		return si.action(table)
+	}
+	switch {
+	case lua.LNil == result || InterceptNext == result.String():
+		return si.Next()
+	case InterceptDrop == result.String():
+		return si.Drop()
+	default:
+		return errors.New("LuaScript返回错误：" + result.String())
+	}
+}
+
+// 脚本以Table返回处理指令：
+// { action = "drop", reason = "BLACKLIST" }：附带原因代码中断事件；
+// { action = "reply", outbound = {...} }：使用自定义消息响应并中断事件；
+// { action = "next", inbound = {...} }：替换Inbound消息并继续处理。
+func (si *ScriptInterceptor) action(table *lua.LTable) error {
+	action := table.RawGetString("action")
+	switch {
+	case lua.LNil == action || InterceptNext == action.String():
+		if inbound, ok := table.RawGetString("inbound").(*lua.LTable); ok {
+			msg, err := lTableToMessage(inbound)
+			if nil != err {
+				return err
+			}
+			return si.Replace(msg)
+		}
+		return si.Next()
+	case InterceptDrop == action.String():
+		if reason := table.RawGetString("reason"); lua.LNil != reason {
+			return si.DropWith(reason.String())
+		}
+		return si.Drop()
+	case InterceptReply == action.String():
+		if outbound, ok := table.RawGetString("outbound").(*lua.LTable); ok {
+			msg, err := lTableToMessage(outbound)
+			if nil != err {
+				return err
+			}
+			return si.Reply(msg)
+		}
+		return si.Reply(nil)
+	default:
+		return errors.New("LuaScript返回未知的处理指令：" + action.String())
+	}
+}
@@ -0,0 +1,66 @@
+package lua
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/yoojia/go-gecko/v2"
+	"os"
+	"testing"
+)
+
+type testAttrs struct {
+	gecko.Attributes
+	data map[string]interface{}
+}
+
+func (a *testAttrs) Map() map[string]interface{}       { return a.data }
+func (a *testAttrs) Add(key string, value interface{}) { a.data[key] = value }
+
+func TestScriptInterceptor(t *testing.T) {
+	si := NewScriptInterceptor()
+	si.OnInit(map[string]interface{}{
+		"script":    "../cmd/scripts/interceptor-sample.lua",
+		"blacklist": []interface{}{"666", "999"},
+		"guestCard": "888",
+	}, nil)
+	si.OnStart(nil)
+	defer si.OnStop(nil)
+
+	attrs := &testAttrs{data: make(map[string]interface{})}
+	err := si.Handle(attrs, "/door/1", "uuid", gecko.NewMessagePacketFields(map[string]interface{}{"card": "123"}), nil)
+	assert.NoError(t, err)
+	assert.Empty(t, attrs.data)
+
+	err = si.Handle(attrs, "/door/1", "uuid", gecko.NewMessagePacketFields(map[string]interface{}{"card": "999"}), nil)
+	assert.True(t, gecko.IsInterceptorDropped(err))
+	assert.Equal(t, "BLACKLIST", err.(*gecko.InterceptedResult).Reason())
+	assert.Equal(t, "999", attrs.data["@Script.Blocked"])
+
+	err = si.Handle(attrs, "/door/1", "uuid", gecko.NewMessagePacketFields(map[string]interface{}{"card": "888"}), nil)
+	assert.Equal(t, si.Reply(gecko.NewMessagePacketFields(map[string]interface{}{"door": "open", "guest": true})), err)
+}
+
+const testFramesInterceptorScript = `
+function interceptMain(args, request)
+    if request.topic == "/door/reply" then
+        return { action = "reply", outbound = { frames = "ACK:" .. request.inbound.frames, code = 0 } }, nil
+    end
+    return { action = "next", inbound = { frames = string.upper(request.inbound.frames), card = "123" } }, nil
+end
+`
+
+func TestScriptInterceptorFrames(t *testing.T) {
+	script := writeTestScript(t, testFramesInterceptorScript)
+	defer os.Remove(script)
+	si := NewScriptInterceptor()
+	si.OnInit(map[string]interface{}{"script": script}, nil)
+	si.OnStart(nil)
+	defer si.OnStop(nil)
+
+	attrs := &testAttrs{data: make(map[string]interface{})}
+	in := gecko.NewMessagePacketFrames([]byte("abc"))
+	err := si.Handle(attrs, "/door/replace", "uuid", in, nil)
+	assert.Equal(t, si.Replace(gecko.NewMessagePacketWith(map[string]interface{}{"card": "123"}, []byte("ABC"))), err)
+
+	err = si.Handle(attrs, "/door/reply", "uuid", in, nil)
+	assert.Equal(t, si.Reply(gecko.NewMessagePacketWith(map[string]interface{}{"code": float64(0)}, []byte("ACK:abc"))), err)
+}
@@ -0,0 +1,102 @@
+package lua
+
+import (
+	"github.com/yoojia/go-gecko/v2"
+	"github.com/yoojia/go-value"
+	"github.com/yuin/gopher-lua"
+)
+
+//
+// Author: 陈哈哈 chenyongjia@parkingwang.com, yoojiachen@gmail.com
+//
+
+func ScriptLogicDeviceFactory() (string, gecko.Factory) {
+	return "ScriptLogicDevice", func() interface{} {
+		return NewScriptLogicDevice()
+	}
+}
+
+func NewScriptLogicDevice() *ScriptLogicDevice {
+	return &ScriptLogicDevice{
+		AbcLogicDevice: gecko.NewAbcLogicDevice(),
+	}
+}
+
+// Lua脚本逻辑设备，通过外置Lua脚本的 checkIfMatch 和 transform 函数，实现逻辑设备的映射规则。
+// InputDevice可能并发发起请求，脚本运行在LState池中。
+type ScriptLogicDevice struct {
+	*gecko.AbcLogicDevice
+	scriptFile string
+	poolConfig lStatePoolConfig
+	pool       *lStatePool
+	args       map[string]interface{}
+}
+
+func (d *ScriptLogicDevice) OnInit(args map[string]interface{}, ctx gecko.Context) {
+	d.args = args
+	d.scriptFile = value.Of(args["script"]).String()
+	if "" == d.scriptFile {
+		log.Panic("参数[script]是必须的")
+	}
+	d.poolConfig = lStatePoolConfigOf(args, ctx)
+}
+
+func (d *ScriptLogicDevice) OnStart(ctx gecko.Context) {
+	pool, err := newLStatePool(d.scriptFile, d.poolConfig)
+	if nil != err {
+		log.Panic(err)
+	}
+	d.pool = pool
+}
+
+func (d *ScriptLogicDevice) OnStop(ctx gecko.Context) {
+	d.pool.close()
+}
+
+func (d *ScriptLogicDevice) CheckIfMatch(msg *gecko.MessagePacket) bool {
+	L, err := d.pool.get()
+	if nil != err {
+		log.Error("Lua.logic获取LState出错: ", err)
+		return false
+	}
+	defer d.pool.put(L)
+	// Lua的函数原型： function checkIfMatch(args, inbound) bool
+	L.Push(L.GetGlobal("checkIfMatch"))
+	L.Push(mapToLTable(d.args))
+	L.Push(messageToLTable(msg))
+	if err := d.pool.call(L, 2, 1); err != nil {
+		log.Error("Lua.logic脚本发生错误("+d.scriptFile+"): ", err)
+		return false
+	}
+	ret := lua.LVAsBool(L.Get(1))
+	L.Pop(1)
+	return ret
+}
+
+func (d *ScriptLogicDevice) Transform(msg *gecko.MessagePacket) *gecko.MessagePacket {
+	L, err := d.pool.get()
+	if nil != err {
+		log.Error("Lua.logic获取LState出错: ", err)
+		return msg
+	}
+	defer d.pool.put(L)
+	// Lua的函数原型： function transform(args, inbound) table
+	L.Push(L.GetGlobal("transform"))
+	L.Push(mapToLTable(d.args))
+	L.Push(messageToLTable(msg))
+	if err := d.pool.call(L, 2, 1); err != nil {
+		log.Error("Lua.logic脚本发生错误("+d.scriptFile+"): ", err)
+		return msg
+	}
+	ret := L.ToTable(1)
+	L.Pop(1)
+	if nil == ret {
+		return msg
+	}
+	out, err := lTableToMessage(ret)
+	if nil != err {
+		log.Error("Lua.logic脚本返回数据错误("+d.scriptFile+"): ", err)
+		return msg
+	}
+	return out
+}
@@ -0,0 +1,24 @@
+package lua
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/yoojia/go-gecko/v2"
+	"testing"
+)
+
+func TestScriptLogicDevice(t *testing.T) {
+	logic := NewScriptLogicDevice()
+	logic.OnInit(map[string]interface{}{
+		"script": "../cmd/scripts/logic-sample.lua",
+		"door":   int64(2),
+	}, nil)
+	logic.OnStart(nil)
+	defer logic.OnStop(nil)
+
+	assert.False(t, logic.CheckIfMatch(gecko.NewMessagePacketFields(map[string]interface{}{"door": "1"})))
+	in := gecko.NewMessagePacketFields(map[string]interface{}{"door": "2", "card": "123"})
+	assert.True(t, logic.CheckIfMatch(in))
+	out := logic.Transform(in)
+	assert.Equal(t, "123", out.GetFieldOrNil("card"))
+	assert.Equal(t, float64(2), out.GetFieldOrNil("logicDoor"))
+}
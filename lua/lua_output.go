@@ -9,16 +9,22 @@ import (
 
 func ScriptOutputFactory() (string, gecko.Factory) {
 	return "ScriptOutput", func() interface{} {
-		return &ScriptOutput{
-			AbcOutputDevice: gecko.NewAbcOutputDevice(),
-		}
+		return NewScriptOutput()
 	}
 }
 
+func NewScriptOutput() *ScriptOutput {
+	return &ScriptOutput{
+		AbcOutputDevice: gecko.NewAbcOutputDevice(),
+	}
+}
+
+// Lua脚本输出设备。多个Driver/Trigger可能并发调用Process函数，每个调用从LState池中独占一个已加载脚本的LState。
 type ScriptOutput struct {
 	*gecko.AbcOutputDevice
 	scriptFile string
-	L          *lua.LState
+	poolConfig lStatePoolConfig
+	pool       *lStatePool
 	args       map[string]interface{}
 }
 
@@ -28,40 +34,47 @@ func (d *ScriptOutput) OnInit(args map[string]interface{}, ctx gecko.Context) {
 	if "" == d.scriptFile {
 		log.Panic("参数[script]是必须的")
 	}
+	d.poolConfig = lStatePoolConfigOf(args, ctx)
 }
 
 func (d *ScriptOutput) OnStart(ctx gecko.Context) {
-	d.L = NewLuaEngine()
-	if err := d.L.DoFile(d.scriptFile); nil != err {
-		log.Panicf("加载LUA脚本出错: %s", d.scriptFile, err)
+	pool, err := newLStatePool(d.scriptFile, d.poolConfig)
+	if nil != err {
+		log.Panic(err)
 	}
+	d.pool = pool
 }
 
 func (d *ScriptOutput) OnStop(ctx gecko.Context) {
-	d.L.Close()
+	d.pool.close()
 }
 
 func (d *ScriptOutput) Process(frame gecko.FramePacket, ctx gecko.Context) (gecko.FramePacket, error) {
+	L, err := d.pool.get()
+	if nil != err {
+		return nil, err
+	}
+	defer d.pool.put(L)
 	// Lua的函数原型： function processMain(argsTable, frame) (string, error)
 	// 先函数，后参数，正序入栈:
-	d.L.Push(d.L.GetGlobal("outputMain"))
+	L.Push(L.GetGlobal("outputMain"))
 	// Arg 1
-	d.L.Push(mapToLTable(d.args))
+	L.Push(mapToLTable(d.args))
 	// Arg 2
-	d.L.Push(lua.LString(string(frame)))
+	L.Push(lua.LString(string(frame)))
 
 	// 2 - Lua定义的入口main函数-返回值数量
-	if err := d.L.PCall(2, 2, nil); err != nil {
+	if err := d.pool.call(L, 2, 2); err != nil {
 		log.Error("Lua.output 脚本发生错误("+d.scriptFile+"): ", err)
 		return nil, err
 	}
 
 	// 函数调用后，参数和函数全部出栈，此时栈中为函数返回值。
-	ret := d.L.ToString(1)
-	err := d.L.ToString(2)
-	d.L.Pop(2) // remove received
-	if "" != err {
-		return nil, errors.New("LuaScript返回错误：" + err)
+	ret := L.ToString(1)
+	retErr := L.ToString(2)
+	L.Pop(2) // remove received
+	if "" != retErr {
+		return nil, errors.New("LuaScript返回错误：" + retErr)
 	} else {
 		ctx.OnIfLogV(func() {
 			log.Debug("LuaScript[Output]返回: " + ret)
@@ -4,7 +4,6 @@ import (
 	"errors"
 	"github.com/yoojia/go-gecko/v2"
 	"github.com/yoojia/go-value"
-	"github.com/yuin/gopher-lua"
 )
 
 //
@@ -24,11 +23,13 @@ func NewScriptTrigger() *ScriptTrigger {
 }
 
 // Lua脚本触发器，通过外置Lua脚本，执行其 trigger 函数。
+// 同一事件的多个Trigger并发执行，每个调用从LState池中独占一个已加载脚本的LState。
 type ScriptTrigger struct {
 	*gecko.AbcTrigger
 	gecko.LifeCycle
 	scriptFile string
-	L          *lua.LState
+	poolConfig lStatePoolConfig
+	pool       *lStatePool
 	args       map[string]interface{}
 }
 
@@ -38,31 +39,38 @@ func (d *ScriptTrigger) OnInit(args map[string]interface{}, ctx gecko.Context) {
 	if "" == d.scriptFile {
 		log.Panic("参数[script]是必须的")
 	}
+	d.poolConfig = lStatePoolConfigOf(args, ctx)
 }
 
 func (d *ScriptTrigger) OnStart(ctx gecko.Context) {
-	d.L = NewLuaEngine()
-	if err := d.L.DoFile(d.scriptFile); nil != err {
-		log.Panicf("加载LUA脚本出错("+d.scriptFile+"): ", err)
+	pool, err := newLStatePool(d.scriptFile, d.poolConfig)
+	if nil != err {
+		log.Panic(err)
 	}
+	d.pool = pool
 }
 
 func (d *ScriptTrigger) OnStop(ctx gecko.Context) {
-	d.L.Close()
+	d.pool.close()
 }
 
 func (d *ScriptTrigger) Touch(attrs gecko.Attributes, topic string, uuid string, in *gecko.MessagePacket,
 	deliverer gecko.OutputDeliverer, ctx gecko.Context) error {
+	L, err := d.pool.get()
+	if nil != err {
+		return err
+	}
+	defer d.pool.put(L)
 	// Lua的函数原型： function triggerMain(args, inbounds, deliverFn) error
-	nArgs := setupDeliLuaFn(d.L, d.args, "triggerMain", attrs, topic, uuid, in, deliverer)
+	nArgs := setupDeliLuaFn(L, d.args, "triggerMain", attrs, topic, uuid, in, deliverer)
 	// 2 - Lua定义的入口main函数-返回值数量
-	if err := d.L.PCall(nArgs, 1, nil); err != nil {
+	if err := d.pool.call(L, nArgs, 1); err != nil {
 		log.Error("Lua.trigger 脚本发生错误("+d.scriptFile+"): ", err)
 		return err
 	}
 	// 函数调用后，参数和函数全部出栈，此时栈中为函数返回值。
-	retErr := d.L.ToString(1)
-	d.L.Pop(1) // remove received
+	retErr := L.ToString(1)
+	L.Pop(1) // remove received
 	if "" != retErr {
 		return errors.New("LuaScript返回错误:" + retErr)
 	} else {
@@ -21,20 +21,19 @@ func setupDeliLuaFn(
 	// Arg 1
 	L.Push(mapToLTable(args))
 	// Arg 2
-	req := L.CreateTable(0, 4) // 0 arr, 4 Hash
-	req.RawSet(lua.LString("attrs"), mapToLTable(attrs.Map()))
-	req.RawSet(lua.LString("topic"), lua.LString(topic))
-	req.RawSet(lua.LString("uuid"), lua.LString(uuid))
-	req.RawSet(lua.LString("inbound"), messageToLTable(in))
-	L.Push(req)
+	L.Push(newRequestTable(L, attrs, topic, uuid, in))
 	// Arg 3 为Lua注入的deliver函数，
 	L.Push(L.NewFunction(func(l *lua.LState) int {
 		// 原型为： function deliver(uuid, pack) (pack, error)
 		// Lua函数调用的参数：
 		uuid := l.ToString(1)
-		pack := l.ToTable(2)
+		pack, err := lTableToMessage(l.ToTable(2))
+		if nil != err {
+			l.ArgError(2, err.Error())
+			return 0
+		}
 		// Go调用，并返回结果到Lua中：
-		if ret, err := deliverer.Deliver(uuid, lTableToMessage(pack)); nil != err {
+		if ret, err := deliverer.Deliver(uuid, pack); nil != err {
 			log.Error("Go.deliver发生错误@"+entryFnName+": ", err)
 			l.Push(lua.LNil)
 			l.Push(lua.LString(err.Error()))
@@ -48,3 +47,20 @@ func setupDeliLuaFn(
 
 	return 3 // 封装的函数参数个数: Arg 1-3
 }
+
+// 创建脚本入口函数的请求参数Table
+func newRequestTable(L *lua.LState, attrs gecko.Attributes, topic string, uuid string, in *gecko.MessagePacket) *lua.LTable {
+	req := L.CreateTable(0, 5) // 0 arr, 5 Hash
+	values := attrs.Map()
+	req.RawSet(lua.LString("attrs"), mapToLTable(values))
+	// 选中当前组件的Topic表达式中命名通配符捕获的值
+	vars, ok := values[gecko.TopicVarsAttrKey].(map[string]string)
+	if !ok {
+		vars = map[string]string{}
+	}
+	req.RawSet(lua.LString("vars"), GoToLValue(vars))
+	req.RawSet(lua.LString("topic"), lua.LString(topic))
+	req.RawSet(lua.LString("uuid"), lua.LString(uuid))
+	req.RawSet(lua.LString("inbound"), messageToLTable(in))
+	return req
+}
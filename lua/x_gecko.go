@@ -0,0 +1,388 @@
+package lua
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/yoojia/go-gecko/v2"
+	"github.com/yoojia/go-gecko/v2/utils"
+	"github.com/yuin/gopher-lua"
+	"time"
+)
+
+//
+// Author: 陈哈哈 chenyongjia@parkingwang.com, yoojiachen@gmail.com
+//
+
+// 预加载到脚本中的gecko模块名称。脚本中使用 `local gecko = require("gecko")` 加载。
+const GeckoModuleName = "gecko"
+
+const (
+	byteWriterTypeName = "gecko.ByteWriter"
+	byteReaderTypeName = "gecko.ByteReader"
+	// 默认时间格式
+	defaultTimeLayout = "2006-01-02 15:04:05"
+)
+
+// 预加载gecko模块。模块提供的函数：
+//
+//	日志：debug/info/warn/error(msg, key, value, ...)，通过Pipeline的日志输出；
+//	Context：getScoped(key)，putScoped(key, value)，domain()，nodeId()，version()，globalConfig()，outputs()；
+//	编码：json.encode/decode，hex.encode/decode，base64.encode/decode；
+//	字节：bytes.writer([order])，bytes.reader(data [, order])，order为 "big"（默认）或者 "little"；
+//	时间：time.now() 毫秒时间戳，time.unix() 秒时间戳，time.format(sec [, layout])，time.parse(text [, layout])；
+//
+// 解码类函数出错时返回 nil, error；ctx为nil时，Context相关函数抛出错误。
+func preloadGecko(L *lua.LState, ctx gecko.Context) {
+	if _, ok := L.GetGlobal(LoadLibName).(*lua.LTable); !ok {
+		return
+	}
+	L.PreloadModule(GeckoModuleName, func(L *lua.LState) int {
+		registerBytesTypes(L)
+		mod := L.NewTable()
+		L.SetFuncs(mod, map[string]lua.LGFunction{
+			"debug": geckoLogFn(log.Debugw),
+			"info":  geckoLogFn(log.Infow),
+			"warn":  geckoLogFn(log.Warnw),
+			"error": geckoLogFn(log.Errorw),
+		})
+		L.SetFuncs(mod, geckoContextFns(ctx))
+		L.SetField(mod, "state", L.SetFuncs(L.NewTable(), geckoStateFns(ctx)))
+		L.SetField(mod, "json", L.SetFuncs(L.NewTable(), map[string]lua.LGFunction{
+			"encode": geckoJsonEncode,
+			"decode": geckoJsonDecode,
+		}))
+		L.SetField(mod, "hex", L.SetFuncs(L.NewTable(), map[string]lua.LGFunction{
+			"encode": func(L *lua.LState) int {
+				L.Push(lua.LString(hex.EncodeToString([]byte(L.CheckString(1)))))
+				return 1
+			},
+			"decode": func(L *lua.LState) int {
+				data, err := hex.DecodeString(L.CheckString(1))
+				return pushResult(L, lua.LString(string(data)), err)
+			},
+		}))
+		L.SetField(mod, "base64", L.SetFuncs(L.NewTable(), map[string]lua.LGFunction{
+			"encode": func(L *lua.LState) int {
+				L.Push(lua.LString(base64.StdEncoding.EncodeToString([]byte(L.CheckString(1)))))
+				return 1
+			},
+			"decode": func(L *lua.LState) int {
+				data, err := base64.StdEncoding.DecodeString(L.CheckString(1))
+				return pushResult(L, lua.LString(string(data)), err)
+			},
+		}))
+		L.SetField(mod, "bytes", L.SetFuncs(L.NewTable(), map[string]lua.LGFunction{
+			"writer": newByteWriter,
+			"reader": newByteReader,
+		}))
+		L.SetField(mod, "time", L.SetFuncs(L.NewTable(), map[string]lua.LGFunction{
+			"now": func(L *lua.LState) int {
+				L.Push(lua.LNumber(time.Now().UnixNano() / int64(time.Millisecond)))
+				return 1
+			},
+			"unix": func(L *lua.LState) int {
+				L.Push(lua.LNumber(time.Now().Unix()))
+				return 1
+			},
+			"format": func(L *lua.LState) int {
+				sec := float64(L.CheckNumber(1))
+				t := time.Unix(int64(sec), int64((sec-float64(int64(sec)))*1e9))
+				L.Push(lua.LString(t.Format(L.OptString(2, defaultTimeLayout))))
+				return 1
+			},
+			"parse": func(L *lua.LState) int {
+				t, err := time.ParseInLocation(L.OptString(2, defaultTimeLayout), L.CheckString(1), time.Local)
+				if nil != err {
+					L.Push(lua.LNil)
+					L.Push(lua.LString(err.Error()))
+					return 2
+				}
+				L.Push(lua.LNumber(t.Unix()))
+				return 1
+			},
+		}))
+		L.Push(mod)
+		return 1
+	})
+}
+
+func geckoLogFn(logw func(msg string, keysAndValues ...interface{})) lua.LGFunction {
+	return func(L *lua.LState) int {
+		msg := L.CheckString(1)
+		kvs := make([]interface{}, 0, L.GetTop()-1)
+		for i := 2; i <= L.GetTop(); i++ {
+			kvs = append(kvs, checkGoValue(L, i))
+		}
+		logw(msg, kvs...)
+		return 0
+	}
+}
+
+func geckoContextFns(ctx gecko.Context) map[string]lua.LGFunction {
+	checkCtx := func(L *lua.LState) gecko.Context {
+		if nil == ctx {
+			L.RaiseError("gecko: context is not available")
+		}
+		return ctx
+	}
+	return map[string]lua.LGFunction{
+		"getScoped": func(L *lua.LState) int {
+			L.Push(GoToLValue(checkCtx(L).GetScoped(L.CheckString(1))))
+			return 1
+		},
+		"putScoped": func(L *lua.LState) int {
+			key := L.CheckString(1)
+			c := checkCtx(L)
+			// Context的ScopedKey不可重复
+			if nil != c.GetScoped(key) {
+				L.Push(lua.LFalse)
+				L.Push(lua.LString("scoped key already exists: " + key))
+				return 2
+			}
+			c.PutScoped(key, checkGoValue(L, 2))
+			L.Push(lua.LTrue)
+			return 1
+		},
+		"domain": func(L *lua.LState) int {
+			L.Push(lua.LString(checkCtx(L).Domain()))
+			return 1
+		},
+		"nodeId": func(L *lua.LState) int {
+			L.Push(lua.LString(checkCtx(L).NodeId()))
+			return 1
+		},
+		"version": func(L *lua.LState) int {
+			L.Push(lua.LString(checkCtx(L).Version()))
+			return 1
+		},
+		"globalConfig": func(L *lua.LState) int {
+			L.Push(mapToLTable(checkCtx(L).GlobalConfig()))
+			return 1
+		},
+		"outputs": func(L *lua.LState) int {
+			out := L.NewTable()
+			utils.ForEach(checkCtx(L).GetOutputDevices(), func(it interface{}) {
+				out.Append(lua.LString(it.(gecko.OutputDevice).GetUuid()))
+			})
+			L.Push(out)
+			return 1
+		},
+	}
+}
+
+func geckoStateFns(ctx gecko.Context) map[string]lua.LGFunction {
+	checkStore := func(L *lua.LState) gecko.StateStore {
+		if nil == ctx || nil == ctx.StateStore() {
+			L.RaiseError("gecko: state store is not available")
+		}
+		return ctx.StateStore()
+	}
+	return map[string]lua.LGFunction{
+		"get": func(L *lua.LState) int {
+			v, _ := checkStore(L).Get(L.CheckString(1))
+			L.Push(GoToLValue(v))
+			return 1
+		},
+		"set": func(L *lua.LState) int {
+			store := checkStore(L)
+			err := store.Set(L.CheckString(1), checkGoValue(L, 2), checkTTL(L, 3))
+			return pushResult(L, lua.LTrue, err)
+		},
+		"delete": func(L *lua.LState) int {
+			return pushResult(L, lua.LTrue, checkStore(L).Delete(L.CheckString(1)))
+		},
+		"cas": func(L *lua.LState) int {
+			store := checkStore(L)
+			ok, err := store.CompareAndSet(L.CheckString(1), optGoValue(L, 2), checkGoValue(L, 3), checkTTL(L, 4))
+			return pushResult(L, lua.LBool(ok), err)
+		},
+		"incr": func(L *lua.LState) int {
+			store := checkStore(L)
+			next, err := store.Increment(L.CheckString(1), L.OptInt64(2, 1), checkTTL(L, 3))
+			return pushResult(L, lua.LNumber(next), err)
+		},
+		"keys": func(L *lua.LState) int {
+			out := L.NewTable()
+			for _, key := range checkStore(L).Keys(L.OptString(1, "")) {
+				out.Append(lua.LString(key))
+			}
+			L.Push(out)
+			return 1
+		},
+	}
+}
+
+// 返回函数结果；出错时返回 nil, error
+func pushResult(L *lua.LState, ret lua.LValue, err error) int {
+	if nil != err {
+		L.Push(lua.LNil)
+		L.Push(lua.LString(err.Error()))
+		return 2
+	}
+	L.Push(ret)
+	return 1
+}
+
+// 读取参数并转换为Go数据；参数缺失或者无法转换时抛出参数错误
+func checkGoValue(L *lua.LState, idx int) interface{} {
+	L.CheckAny(idx)
+	return optGoValue(L, idx)
+}
+
+// 读取参数并转换为Go数据；参数为nil时返回nil
+func optGoValue(L *lua.LState, idx int) interface{} {
+	v, err := LValueToGo(L.Get(idx))
+	if nil != err {
+		L.ArgError(idx, err.Error())
+	}
+	return v
+}
+
+// 读取TTL参数：数值为毫秒数，字符串为Go的Duration格式
+func checkTTL(L *lua.LState, idx int) time.Duration {
+	switch v := L.Get(idx).(type) {
+	case lua.LNumber:
+		return time.Duration(float64(v) * float64(time.Millisecond))
+	case lua.LString:
+		d, err := time.ParseDuration(string(v))
+		if nil != err {
+			L.ArgError(idx, "invalid ttl: "+string(v))
+		}
+		return d
+	case *lua.LNilType:
+		return 0
+	default:
+		L.ArgError(idx, "ttl must be a number or string")
+		return 0
+	}
+}
+
+func geckoJsonEncode(L *lua.LState) int {
+	val, err := LValueToGo(L.CheckAny(1))
+	var data []byte
+	if nil == err {
+		data, err = json.Marshal(val)
+	}
+	if nil != err {
+		L.Push(lua.LNil)
+		L.Push(lua.LString(err.Error()))
+		return 2
+	}
+	L.Push(lua.LString(string(data)))
+	return 1
+}
+
+func geckoJsonDecode(L *lua.LState) int {
+	var out interface{}
+	if err := json.Unmarshal([]byte(L.CheckString(1)), &out); nil != err {
+		L.Push(lua.LNil)
+		L.Push(lua.LString(err.Error()))
+		return 2
+	}
+	L.Push(GoToLValue(out))
+	return 1
+}
+
+////
+
+func byteOrderOf(L *lua.LState, idx int) binary.ByteOrder {
+	switch order := L.OptString(idx, "big"); order {
+	case "big":
+		return binary.BigEndian
+	case "little":
+		return binary.LittleEndian
+	default:
+		L.ArgError(idx, "byte order must be big or little: "+order)
+		return nil
+	}
+}
+
+// 注册 utils.ByteWriter / utils.ByteReader 对应的Lua类型。
+// 注意：Lua数值为float64类型，Uint64超过2^53的部分会丢失精度。
+func registerBytesTypes(L *lua.LState) {
+	writer := L.NewTypeMetatable(byteWriterTypeName)
+	L.SetField(writer, "__index", L.SetFuncs(L.NewTable(), map[string]lua.LGFunction{
+		"putByte": func(L *lua.LState) int {
+			checkByteWriter(L).PutByte(byte(L.CheckInt(2)))
+			return 0
+		},
+		"putBytes": func(L *lua.LState) int {
+			checkByteWriter(L).PutBytes([]byte(L.CheckString(2)))
+			return 0
+		},
+		"putUint16": func(L *lua.LState) int {
+			checkByteWriter(L).PutUint16(uint16(L.CheckInt64(2)))
+			return 0
+		},
+		"putUint32": func(L *lua.LState) int {
+			checkByteWriter(L).PutUint32(uint32(L.CheckInt64(2)))
+			return 0
+		},
+		"putUint64": func(L *lua.LState) int {
+			checkByteWriter(L).PutUint64(uint64(L.CheckInt64(2)))
+			return 0
+		},
+		"bytes": func(L *lua.LState) int {
+			L.Push(lua.LString(string(checkByteWriter(L).Bytes())))
+			return 1
+		},
+	}))
+	reader := L.NewTypeMetatable(byteReaderTypeName)
+	L.SetField(reader, "__index", L.SetFuncs(L.NewTable(), map[string]lua.LGFunction{
+		"getByte": func(L *lua.LState) int {
+			L.Push(lua.LNumber(checkByteReader(L).GetByte()))
+			return 1
+		},
+		"getBytes": func(L *lua.LState) int {
+			L.Push(lua.LString(string(checkByteReader(L).GetBytesSize(L.CheckInt(2)))))
+			return 1
+		},
+		"getUint16": func(L *lua.LState) int {
+			L.Push(lua.LNumber(checkByteReader(L).GetUint16()))
+			return 1
+		},
+		"getUint32": func(L *lua.LState) int {
+			L.Push(lua.LNumber(checkByteReader(L).GetUint32()))
+			return 1
+		},
+		"getUint64": func(L *lua.LState) int {
+			L.Push(lua.LNumber(checkByteReader(L).GetUint64()))
+			return 1
+		},
+	}))
+}
+
+func newByteWriter(L *lua.LState) int {
+	ud := L.NewUserData()
+	ud.Value = utils.NewByteWriter(byteOrderOf(L, 1))
+	L.SetMetatable(ud, L.GetTypeMetatable(byteWriterTypeName))
+	L.Push(ud)
+	return 1
+}
+
+func newByteReader(L *lua.LState) int {
+	data := []byte(L.CheckString(1))
+	ud := L.NewUserData()
+	ud.Value = utils.WrapByteReader(data, byteOrderOf(L, 2))
+	L.SetMetatable(ud, L.GetTypeMetatable(byteReaderTypeName))
+	L.Push(ud)
+	return 1
+}
+
+func checkByteWriter(L *lua.LState) *utils.ByteWriter {
+	if w, ok := L.CheckUserData(1).Value.(*utils.ByteWriter); ok {
+		return w
+	}
+	L.ArgError(1, "ByteWriter expected")
+	return nil
+}
+
+func checkByteReader(L *lua.LState) *utils.ByteReader {
+	if r, ok := L.CheckUserData(1).Value.(*utils.ByteReader); ok {
+		return r
+	}
+	L.ArgError(1, "ByteReader expected")
+	return nil
+}
@@ -0,0 +1,157 @@
+package lua
+
+import (
+	"container/list"
+	"github.com/stretchr/testify/assert"
+	"github.com/yoojia/go-gecko/v2"
+	"github.com/yuin/gopher-lua"
+	"testing"
+)
+
+type testContext struct {
+	gecko.Context
+	scoped map[interface{}]interface{}
+	store  gecko.StateStore
+}
+
+func (c *testContext) StateStore() gecko.StateStore { return c.store }
+func (c *testContext) Domain() string               { return "test.gecko" }
+func (c *testContext) NodeId() string               { return "node-1" }
+func (c *testContext) GlobalConfig() map[string]interface{} {
+	return map[string]interface{}{"region": "cn"}
+}
+func (c *testContext) GetOutputDevices() *list.List {
+	out := list.New()
+	out.PushBack(&testOutput{AbcOutputDevice: gecko.NewAbcOutputDevice()})
+	return out
+}
+func (c *testContext) GetScoped(key interface{}) interface{} { return c.scoped[key] }
+func (c *testContext) PutScoped(key interface{}, value interface{}) {
+	c.scoped[key] = value
+}
+
+type testOutput struct {
+	*gecko.AbcOutputDevice
+}
+
+func (o *testOutput) GetUuid() string { return "OUTPUT-1" }
+
+func runGeckoScript(t *testing.T, ctx gecko.Context, script string) *lua.LState {
+	L := NewLuaEngine()
+	preloadGecko(L, ctx)
+	assert.NoError(t, L.DoString(script))
+	return L
+}
+
+func TestGeckoModuleContext(t *testing.T) {
+	ctx := &testContext{scoped: make(map[interface{}]interface{})}
+	L := runGeckoScript(t, ctx, `
+		local gecko = require("gecko")
+		assert(gecko.domain() == "test.gecko")
+		assert(gecko.nodeId() == "node-1")
+		assert(gecko.globalConfig().region == "cn")
+		assert(gecko.outputs()[1] == "OUTPUT-1")
+		assert(gecko.putScoped("counter", 1))
+		local ok, err = gecko.putScoped("counter", 2)
+		assert(not ok and err ~= nil)
+		assert(gecko.getScoped("counter") == 1)
+		gecko.info("hello from lua", "key", "value")
+	`)
+	defer L.Close()
+	assert.Equal(t, float64(1), ctx.scoped["counter"])
+}
+
+func TestGeckoModuleWithoutContext(t *testing.T) {
+	L := NewLuaEngine()
+	defer L.Close()
+	preloadGecko(L, nil)
+	err := L.DoString(`require("gecko").domain()`)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "context is not available")
+}
+
+func TestGeckoModuleCodecs(t *testing.T) {
+	L := runGeckoScript(t, nil, `
+		local gecko = require("gecko")
+		local text = gecko.json.encode({name = "gecko", tags = {"a", "b"}})
+		local obj = gecko.json.decode(text)
+		assert(obj.name == "gecko" and obj.tags[2] == "b")
+		local v, err = gecko.json.decode("{bad")
+		assert(v == nil and err ~= nil)
+
+		assert(gecko.hex.encode("\1\171") == "01ab")
+		assert(gecko.hex.decode("01ab") == "\1\171")
+		assert(gecko.base64.decode(gecko.base64.encode("gecko")) == "gecko")
+		v, err = gecko.base64.decode("!!")
+		assert(v == nil and err ~= nil)
+	`)
+	L.Close()
+}
+
+func TestGeckoModuleBytes(t *testing.T) {
+	L := runGeckoScript(t, nil, `
+		local gecko = require("gecko")
+		local w = gecko.bytes.writer("little")
+		w:putByte(0xFF)
+		w:putBytes("\170\187")
+		w:putUint16(2018)
+		w:putUint32(228441083)
+		w:putUint64(13800138000)
+		data = w:bytes()
+
+		local r = gecko.bytes.reader(data, "little")
+		assert(r:getByte() == 0xFF)
+		assert(r:getBytes(2) == "\170\187")
+		assert(r:getUint16() == 2018)
+		assert(r:getUint32() == 228441083)
+		assert(r:getUint64() == 13800138000)
+
+		local be = gecko.bytes.writer()
+		be:putUint16(0x0102)
+		assert(be:bytes() == "\1\2")
+	`)
+	defer L.Close()
+	assert.Equal(t, 1+2+2+4+8, len(L.GetGlobal("data").String()))
+	assert.Error(t, L.DoString(`require("gecko").bytes.writer("middle")`))
+}
+
+func TestGeckoModuleTime(t *testing.T) {
+	L := runGeckoScript(t, nil, `
+		local gecko = require("gecko")
+		unix = gecko.time.unix()
+		now = gecko.time.now()
+		local sec = gecko.time.parse("2019-03-01 08:30:00")
+		assert(gecko.time.format(sec) == "2019-03-01 08:30:00")
+		assert(gecko.time.format(sec, "2006/01/02") == "2019/03/01")
+		local v, err = gecko.time.parse("bad time")
+		assert(v == nil and err ~= nil)
+	`)
+	defer L.Close()
+	assert.True(t, float64(L.GetGlobal("now").(lua.LNumber)) >= float64(L.GetGlobal("unix").(lua.LNumber))*1000)
+}
+
+func TestGeckoModuleState(t *testing.T) {
+	ctx := &testContext{store: gecko.NewMemoryStateStore()}
+	L := runGeckoScript(t, ctx, `
+		local state = require("gecko").state
+		assert(state.get("card") == nil)
+		assert(state.cas("card", nil, "12345", "1m"))
+		assert(state.cas("card", nil, "67890") == false)
+		assert(state.cas("card", "12345", "67890", 60000))
+		assert(state.get("card") == "67890")
+		assert(state.set("door", {open = true}))
+		assert(state.get("door").open == true)
+		assert(state.incr("hits") == 1)
+		assert(state.incr("hits", 2) == 3)
+		local n, err = state.incr("card", 1)
+		assert(n == nil and err ~= nil)
+		local keys = state.keys("d")
+		assert(#keys == 1 and keys[1] == "door")
+		assert(state.delete("door"))
+		assert(state.get("door") == nil)
+	`)
+	defer L.Close()
+	v, ok := ctx.store.Get("hits")
+	assert.True(t, ok)
+	assert.Equal(t, int64(3), v)
+}
@@ -28,36 +28,32 @@ const (
 	MathLibName = "math"
 )
 
+// 默认调用栈大小
+const defaultCallStackSize = 8
+
 type luaLib struct {
+	name    string
 	libName string
 	libFunc glua.LGFunction
 }
 
 var luaLibs = []luaLib{
-	{LoadLibName, glua.OpenPackage},
-	{BaseLibName, glua.OpenBase},
-	{TabLibName, glua.OpenTable},
-	{IoLibName, glua.OpenIo},
-	{OsLibName, glua.OpenOs},
-	{StringLibName, glua.OpenString},
-	{MathLibName, glua.OpenMath},
+	{SandboxLibPackage, LoadLibName, glua.OpenPackage},
+	{SandboxLibBase, BaseLibName, glua.OpenBase},
+	{SandboxLibTable, TabLibName, glua.OpenTable},
+	{SandboxLibIo, IoLibName, glua.OpenIo},
+	{SandboxLibOs, OsLibName, glua.OpenOs},
+	{SandboxLibString, StringLibName, glua.OpenString},
+	{SandboxLibMath, MathLibName, glua.OpenMath},
 }
 
+// 创建开放全部库的Lua引擎。脚本组件默认使用受限的Sandbox，见 sandboxOf。
 func NewLuaEngine() *glua.LState {
-	// 简化Lua虚拟机
-	ls := glua.NewState(glua.Options{
-		CallStackSize: 8,
-		SkipOpenLibs:  true,
-	})
-	// base module
-	for _, lib := range luaLibs {
-		ls.Push(ls.NewFunction(lib.libFunc))
-		ls.Push(glua.LString(lib.libName))
-		ls.Call(1, 0)
-	}
-	// Other module
+	return newSandboxEngine(unrestrictedSandbox())
+}
+
+func preloadHttp(ls *glua.LState) {
 	ls.PreloadModule("http", gluahttp.NewHttpModule(&http.Client{
 		Timeout: time.Second * 10,
 	}).Loader)
-	return ls
 }
@@ -2,34 +2,35 @@ package lua
 
 import (
 	"github.com/yoojia/go-gecko/v2"
-	"github.com/yoojia/go-value"
 	"github.com/yuin/gopher-lua"
 )
 
+// Lua脚本中，MessagePacket.Frames字段以字节字符串的形式保存在Table的frames字段
+const FramesKey = "frames"
+
 func messageToLTable(pack *gecko.MessagePacket) *lua.LTable {
-	if len(pack.GetFrames()) > 0 {
-		log.Error("Lua脚本组件暂不支持MessagePacket.Frames字段")
+	table := mapToLTable(pack.GetFields())
+	if frames := pack.GetFrames(); len(frames) > 0 {
+		if pack.HasField(FramesKey) {
+			log.Warnf("MessagePacket.Fields包含保留字段[%s]，将被Frames数据覆盖", FramesKey)
+		}
+		table.RawSetString(FramesKey, lua.LString(string(frames)))
 	}
-	return mapToLTable(pack.GetFields())
+	return table
 }
 
-func lTableToMessage(table *lua.LTable) *gecko.MessagePacket {
+func lTableToMessage(table *lua.LTable) (*gecko.MessagePacket, error) {
 	if nil == table {
-		return gecko.NewMessagePacketFields(make(map[string]interface{}, 0))
+		return gecko.NewMessagePacketFields(make(map[string]interface{}, 0)), nil
 	}
-	data := make(map[string]interface{}, table.Len())
-	table.ForEach(func(key lua.LValue, val lua.LValue) {
-		k := key.String()
-		switch val.Type() {
-		case lua.LTNumber:
-			data[k] = value.Of(val).MustFloat64()
-
-		case lua.LTString:
-			data[k] = value.Of(val).String()
-
-		case lua.LTBool:
-			data[k] = value.Of(val).MustBool()
-		}
-	})
-	return gecko.NewMessagePacketFields(data)
+	data, err := lTableToMap(table)
+	if nil != err {
+		return nil, err
+	}
+	var frames []byte
+	if str, ok := table.RawGetString(FramesKey).(lua.LString); ok {
+		frames = []byte(string(str))
+		delete(data, FramesKey)
+	}
+	return gecko.NewMessagePacketWith(data, frames), nil
 }
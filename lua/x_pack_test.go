@@ -0,0 +1,52 @@
+package lua
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/yoojia/go-gecko/v2"
+	"testing"
+)
+
+func TestMessageRoundTripWithFramesAndNestedTables(t *testing.T) {
+	L := NewLuaEngine()
+	defer L.Close()
+	err := L.DoString(`
+function echoMain(inbound)
+    assert(string.byte(inbound.frames, 1) == 0xAA)
+    assert(#inbound.frames == 3)
+    assert(inbound.reader.tags[2] == "b")
+    assert(inbound.reader.id == 7)
+    return {
+        frames = string.char(0x01, 0x00, 0xFF),
+        reader = inbound.reader,
+        list = { 1, 2, { x = "y" } },
+        empty = {},
+    }
+end`)
+	assert.NoError(t, err)
+
+	in := gecko.NewMessagePacketWith(map[string]interface{}{
+		"reader": map[string]interface{}{
+			"id":   int64(7),
+			"tags": []interface{}{"a", "b"},
+		},
+	}, []byte{0xAA, 0x00, 0xBB})
+	L.Push(L.GetGlobal("echoMain"))
+	L.Push(messageToLTable(in))
+	assert.NoError(t, L.PCall(1, 1, nil))
+	out, err := lTableToMessage(L.ToTable(1))
+	assert.NoError(t, err)
+	L.Pop(1)
+
+	assert.Equal(t, []byte{0x01, 0x00, 0xFF}, out.GetFrames())
+	assert.False(t, out.HasField(FramesKey))
+	v, ok := out.GetFieldPath("reader.tags[1]")
+	assert.True(t, ok)
+	assert.Equal(t, "b", v)
+	v, _ = out.GetFieldPath("reader.id")
+	assert.Equal(t, float64(7), v)
+	v, _ = out.GetFieldPath("list[2].x")
+	assert.Equal(t, "y", v)
+	v, _ = out.GetFieldPath("list[0]")
+	assert.Equal(t, float64(1), v)
+	assert.Equal(t, map[string]interface{}{}, out.GetFieldOrNil("empty"))
+}
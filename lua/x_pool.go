@@ -0,0 +1,360 @@
+package lua
+
+import (
+	"bufio"
+	"github.com/pkg/errors"
+	"github.com/yoojia/go-gecko/v2"
+	"github.com/yoojia/go-value"
+	"github.com/yuin/gopher-lua"
+	"github.com/yuin/gopher-lua/parse"
+	"os"
+	"sync"
+	"time"
+)
+
+//
+// Author: 陈哈哈 chenyongjia@parkingwang.com, yoojiachen@gmail.com
+//
+
+const (
+	// 默认LState池大小
+	defaultPoolSize = 4
+	// 默认空闲LState回收时间
+	defaultPoolIdleTimeout = time.Minute
+	// 默认脚本文件变更检查间隔
+	defaultReloadInterval = time.Second * 3
+)
+
+// LState池配置
+type lStatePoolConfig struct {
+	// 预加载并常驻的LState数量
+	minSize int
+	// LState的最大数量；全部被占用时，调用方阻塞等待
+	maxSize int
+	// 超过minSize的空闲LState，在空闲时间超过此值后被回收
+	idleTimeout time.Duration
+	// 脚本文件变更检查间隔；为0时不检查
+	reloadInterval time.Duration
+	// 脚本Sandbox配置
+	sandbox *Sandbox
+	// 提供给gecko模块的Context；为nil时gecko模块中依赖Context的函数不可用
+	ctx gecko.Context
+}
+
+// 从组件的InitArgs中读取LState池配置：
+// poolMinSize 默认为1；poolMaxSize 默认为poolSize参数或者4；poolIdleTimeout 默认为1分钟；
+// hotReload 默认为true，hotReloadInterval 默认为3秒；sandbox 参见 sandboxOf 函数。
+func lStatePoolConfigOf(args map[string]interface{}, ctx gecko.Context) lStatePoolConfig {
+	sandbox, err := sandboxOf(args)
+	if nil != err {
+		log.Panicw("脚本配置项[sandbox]错误", "error", err)
+	}
+	maxSize := value.Of(args["poolSize"]).Int64OrDefault(defaultPoolSize)
+	if v, ok := args["poolMaxSize"]; ok {
+		maxSize = value.Of(v).Int64OrDefault(maxSize)
+	}
+	config := lStatePoolConfig{
+		minSize:     int(value.Of(args["poolMinSize"]).Int64OrDefault(1)),
+		maxSize:     int(maxSize),
+		idleTimeout: value.Of(args["poolIdleTimeout"]).DurationOfDefault(defaultPoolIdleTimeout),
+		sandbox:     sandbox,
+		ctx:         ctx,
+	}
+	if v, ok := args["hotReload"]; !ok || value.Of(v).MustBool() {
+		config.reloadInterval = value.Of(args["hotReloadInterval"]).DurationOfDefault(defaultReloadInterval)
+	}
+	return config
+}
+
+type pooledLState struct {
+	L        *lua.LState
+	lastUsed time.Time
+}
+
+// LState池。
+// gopher-lua的LState不是协程安全的，每个并发调用需要独占一个已加载脚本的LState。
+// 池中预加载minSize个LState，按需扩展到maxSize个；超过minSize的空闲LState定时回收。
+// 脚本文件变更后，新版本脚本编译并加载成功才会替换旧版本；正在使用的旧版本LState在归还时关闭。
+type lStatePool struct {
+	scriptFile string
+	config     lStatePoolConfig
+	slots      chan struct{}
+	mu         sync.Mutex
+	proto      *lua.FunctionProto
+	modTime    time.Time
+	generation int
+	inUse      map[*lua.LState]int
+	idle       []*pooledLState
+	total      int
+	closed     bool
+	stop       chan struct{}
+}
+
+// 创建并预加载LState池
+func newLStatePool(scriptFile string, config lStatePoolConfig) (*lStatePool, error) {
+	if config.maxSize <= 0 {
+		config.maxSize = 1
+	}
+	if config.minSize < 0 {
+		config.minSize = 0
+	}
+	if config.minSize > config.maxSize {
+		config.minSize = config.maxSize
+	}
+	if config.idleTimeout <= 0 {
+		config.idleTimeout = defaultPoolIdleTimeout
+	}
+	if nil == config.sandbox {
+		config.sandbox = defaultSandbox()
+	}
+	proto, modTime, err := compileScript(scriptFile)
+	if nil != err {
+		return nil, err
+	}
+	pool := &lStatePool{
+		scriptFile: scriptFile,
+		config:     config,
+		slots:      make(chan struct{}, config.maxSize),
+		proto:      proto,
+		modTime:    modTime,
+		inUse:      make(map[*lua.LState]int),
+		idle:       make([]*pooledLState, 0, config.maxSize),
+		stop:       make(chan struct{}),
+	}
+	states, err := newStates(scriptFile, proto, config, config.minSize)
+	if nil != err {
+		return nil, err
+	}
+	pool.idle = append(pool.idle, states...)
+	pool.total = len(states)
+	go pool.evictLoop()
+	if config.reloadInterval > 0 {
+		go pool.watchLoop()
+	}
+	return pool, nil
+}
+
+// 读取并编译脚本文件
+func compileScript(scriptFile string) (*lua.FunctionProto, time.Time, error) {
+	file, err := os.Open(scriptFile)
+	if nil != err {
+		return nil, time.Time{}, errors.Wrap(err, "读取LUA脚本出错: "+scriptFile)
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if nil != err {
+		return nil, time.Time{}, errors.Wrap(err, "读取LUA脚本出错: "+scriptFile)
+	}
+	chunk, err := parse.Parse(bufio.NewReader(file), scriptFile)
+	if nil != err {
+		return nil, time.Time{}, errors.Wrap(err, "解析LUA脚本出错: "+scriptFile)
+	}
+	proto, err := lua.Compile(chunk, scriptFile)
+	if nil != err {
+		return nil, time.Time{}, errors.Wrap(err, "编译LUA脚本出错: "+scriptFile)
+	}
+	return proto, info.ModTime(), nil
+}
+
+// 使用编译后的脚本创建LState
+func newState(scriptFile string, proto *lua.FunctionProto, config lStatePoolConfig) (*lua.LState, error) {
+	L := newSandboxEngine(config.sandbox)
+	preloadGecko(L, config.ctx)
+	L.Push(L.NewFunctionFromProto(proto))
+	if err := config.sandbox.pcall(L, 0, lua.MultRet); nil != err {
+		L.Close()
+		return nil, errors.Wrap(err, "加载LUA脚本出错: "+scriptFile)
+	}
+	L.SetTop(0)
+	return L, nil
+}
+
+func newStates(scriptFile string, proto *lua.FunctionProto, config lStatePoolConfig, count int) ([]*pooledLState, error) {
+	out := make([]*pooledLState, 0, count)
+	for i := 0; i < count; i++ {
+		L, err := newState(scriptFile, proto, config)
+		if nil != err {
+			for _, ps := range out {
+				ps.L.Close()
+			}
+			return nil, err
+		}
+		out = append(out, &pooledLState{L: L, lastUsed: time.Now()})
+	}
+	return out, nil
+}
+
+// 获取LState；当LState数量达到maxSize并且全部被占用时，阻塞等待。
+func (p *lStatePool) get() (*lua.LState, error) {
+	p.slots <- struct{}{}
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		<-p.slots
+		return nil, errors.New("LState池已关闭: " + p.scriptFile)
+	}
+	if n := len(p.idle); n > 0 {
+		// 后进先出，优先使用最近使用过的LState，使空闲LState可以被回收
+		ps := p.idle[n-1]
+		p.idle = p.idle[:n-1]
+		p.inUse[ps.L] = p.generation
+		p.mu.Unlock()
+		return ps.L, nil
+	}
+	p.total++
+	proto, generation := p.proto, p.generation
+	p.mu.Unlock()
+	L, err := newState(p.scriptFile, proto, p.config)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if nil != err {
+		p.total--
+		<-p.slots
+		return nil, err
+	}
+	p.inUse[L] = generation
+	return L, nil
+}
+
+// 归还LState
+func (p *lStatePool) put(L *lua.LState) {
+	// 清理调用过程残留在栈中的数据
+	L.SetTop(0)
+	p.mu.Lock()
+	generation := p.inUse[L]
+	delete(p.inUse, L)
+	if p.closed || generation != p.generation {
+		// 已关闭，或者脚本已重新加载
+		p.total--
+		L.Close()
+	} else {
+		p.idle = append(p.idle, &pooledLState{L: L, lastUsed: time.Now()})
+	}
+	p.mu.Unlock()
+	<-p.slots
+}
+
+// 在Sandbox限制下调用栈中的函数；超过限制时返回 ErrScriptTimeout / ErrScriptLimit 错误。
+func (p *lStatePool) call(L *lua.LState, nArgs int, nRets int) error {
+	return p.config.sandbox.pcall(L, nArgs, nRets)
+}
+
+// 返回LState总数和空闲数量
+func (p *lStatePool) stats() (total int, idle int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.total, len(p.idle)
+}
+
+// 检查脚本文件是否变更；变更后编译并加载新版本脚本，成功后替换旧版本。
+// 返回是否发生替换；新版本脚本出错时，保留旧版本并返回错误。
+func (p *lStatePool) reload() (bool, error) {
+	info, err := os.Stat(p.scriptFile)
+	if nil != err {
+		return false, errors.Wrap(err, "读取LUA脚本出错: "+p.scriptFile)
+	}
+	p.mu.Lock()
+	unchanged := info.ModTime().Equal(p.modTime)
+	p.mu.Unlock()
+	if unchanged {
+		return false, nil
+	}
+	proto, modTime, err := compileScript(p.scriptFile)
+	if nil == err {
+		// 至少加载一个LState，确认新版本脚本可以正常执行
+		count := p.config.minSize
+		if count < 1 {
+			count = 1
+		}
+		var states []*pooledLState
+		if states, err = newStates(p.scriptFile, proto, p.config, count); nil == err {
+			p.swap(proto, modTime, states)
+			return true, nil
+		}
+	}
+	// 记录出错版本的修改时间，文件再次变更前不再重复加载
+	p.mu.Lock()
+	p.modTime = info.ModTime()
+	p.mu.Unlock()
+	return false, err
+}
+
+func (p *lStatePool) swap(proto *lua.FunctionProto, modTime time.Time, states []*pooledLState) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		for _, ps := range states {
+			ps.L.Close()
+		}
+		return
+	}
+	for _, ps := range p.idle {
+		ps.L.Close()
+	}
+	p.total = p.total - len(p.idle) + len(states)
+	p.idle = states
+	p.proto = proto
+	p.modTime = modTime
+	p.generation++
+}
+
+func (p *lStatePool) watchLoop() {
+	ticker := time.NewTicker(p.config.reloadInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.stop:
+			return
+		case <-ticker.C:
+			if reloaded, err := p.reload(); nil != err {
+				log.Errorw("LUA脚本重新加载失败，继续使用旧版本", "script", p.scriptFile, "error", err)
+			} else if reloaded {
+				log.Infow("LUA脚本已重新加载", "script", p.scriptFile)
+			}
+		}
+	}
+}
+
+func (p *lStatePool) evictLoop() {
+	ticker := time.NewTicker(p.config.idleTimeout / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.stop:
+			return
+		case <-ticker.C:
+			p.evictIdle(time.Now())
+		}
+	}
+}
+
+// 回收超过minSize并且空闲超时的LState
+func (p *lStatePool) evictIdle(now time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	// idle列表按归还时间排序，最早归还的在列表头部
+	for len(p.idle) > 0 && p.total > p.config.minSize {
+		ps := p.idle[0]
+		if now.Sub(ps.lastUsed) < p.config.idleTimeout {
+			break
+		}
+		p.idle = p.idle[1:]
+		p.total--
+		ps.L.Close()
+	}
+}
+
+func (p *lStatePool) close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return
+	}
+	p.closed = true
+	close(p.stop)
+	for _, ps := range p.idle {
+		ps.L.Close()
+	}
+	p.total -= len(p.idle)
+	p.idle = nil
+}
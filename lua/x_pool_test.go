@@ -0,0 +1,128 @@
+package lua
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/yuin/gopher-lua"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestLStatePoolGrowAndEvict(t *testing.T) {
+	script := writeTestScript(t, `function hello() return "world" end`)
+	defer os.Remove(script)
+
+	pool, err := newLStatePool(script, lStatePoolConfig{minSize: 1, maxSize: 3, idleTimeout: time.Hour})
+	assert.NoError(t, err)
+	defer pool.close()
+	total, idle := pool.stats()
+	assert.Equal(t, 1, total)
+	assert.Equal(t, 1, idle)
+
+	states := make([]*lua.LState, 0)
+	for i := 0; i < 3; i++ {
+		L, err := pool.get()
+		assert.NoError(t, err)
+		states = append(states, L)
+	}
+	total, idle = pool.stats()
+	assert.Equal(t, 3, total)
+	assert.Equal(t, 0, idle)
+
+	// 超出maxSize时阻塞等待
+	acquired := make(chan struct{})
+	go func() {
+		L, err := pool.get()
+		assert.NoError(t, err)
+		pool.put(L)
+		close(acquired)
+	}()
+	select {
+	case <-acquired:
+		t.Fatal("pool should block when all states are in use")
+	case <-time.After(50 * time.Millisecond):
+	}
+	for _, L := range states {
+		pool.put(L)
+	}
+	<-acquired
+
+	// 空闲超时后回收到minSize
+	pool.evictIdle(time.Now().Add(2 * time.Hour))
+	total, idle = pool.stats()
+	assert.Equal(t, 1, total)
+	assert.Equal(t, 1, idle)
+}
+
+func TestLStatePoolConfigOf(t *testing.T) {
+	c := lStatePoolConfigOf(map[string]interface{}{"poolSize": int64(8)}, nil)
+	assert.Equal(t, 1, c.minSize)
+	assert.Equal(t, 8, c.maxSize)
+	assert.Equal(t, defaultPoolIdleTimeout, c.idleTimeout)
+
+	c = lStatePoolConfigOf(map[string]interface{}{"poolMinSize": int64(2), "poolMaxSize": int64(6), "poolIdleTimeout": "10s"}, nil)
+	assert.Equal(t, 2, c.minSize)
+	assert.Equal(t, 6, c.maxSize)
+	assert.Equal(t, 10*time.Second, c.idleTimeout)
+}
+
+func callHello(t *testing.T, L *lua.LState) string {
+	L.Push(L.GetGlobal("hello"))
+	assert.NoError(t, L.PCall(0, 1, nil))
+	ret := L.ToString(1)
+	L.Pop(1)
+	return ret
+}
+
+func rewriteScript(t *testing.T, file string, script string, modTime time.Time) {
+	assert.NoError(t, ioutil.WriteFile(file, []byte(script), 0644))
+	assert.NoError(t, os.Chtimes(file, modTime, modTime))
+}
+
+func TestLStatePoolReload(t *testing.T) {
+	script := writeTestScript(t, `function hello() return "v1" end`)
+	defer os.Remove(script)
+
+	pool, err := newLStatePool(script, lStatePoolConfig{minSize: 1, maxSize: 2, idleTimeout: time.Hour})
+	assert.NoError(t, err)
+	defer pool.close()
+
+	reloaded, err := pool.reload()
+	assert.NoError(t, err)
+	assert.False(t, reloaded)
+
+	old, err := pool.get()
+	assert.NoError(t, err)
+	assert.Equal(t, "v1", callHello(t, old))
+
+	rewriteScript(t, script, `function hello() return "v2" end`, time.Now().Add(time.Minute))
+	reloaded, err = pool.reload()
+	assert.NoError(t, err)
+	assert.True(t, reloaded)
+
+	L, err := pool.get()
+	assert.NoError(t, err)
+	assert.Equal(t, "v2", callHello(t, L))
+	pool.put(L)
+	// 旧版本的LState归还时被关闭
+	pool.put(old)
+	total, idle := pool.stats()
+	assert.Equal(t, 1, total)
+	assert.Equal(t, 1, idle)
+
+	// 语法错误时保留旧版本
+	rewriteScript(t, script, `function hello() return "v3" `, time.Now().Add(2*time.Minute))
+	reloaded, err = pool.reload()
+	assert.Error(t, err)
+	assert.False(t, reloaded)
+	L, err = pool.get()
+	assert.NoError(t, err)
+	assert.Equal(t, "v2", callHello(t, L))
+	pool.put(L)
+
+	// 出错版本不重复加载
+	reloaded, err = pool.reload()
+	assert.NoError(t, err)
+	assert.False(t, reloaded)
+}
@@ -0,0 +1,338 @@
+package lua
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"github.com/yoojia/go-gecko/v2/utils"
+	"github.com/yoojia/go-value"
+	glua "github.com/yuin/gopher-lua"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+//
+// Author: 陈哈哈 chenyongjia@parkingwang.com, yoojiachen@gmail.com
+//
+
+var (
+	// 脚本执行时间超过Sandbox限制
+	ErrScriptTimeout = errors.New("LUA_SCRIPT_TIMEOUT")
+	// 脚本调用栈或者数据栈超过Sandbox限制
+	ErrScriptLimit = errors.New("LUA_SCRIPT_LIMIT_EXCEEDED")
+	// 脚本访问Sandbox文件系统根目录之外的文件
+	ErrScriptFsDenied = errors.New("LUA_SCRIPT_FS_DENIED")
+)
+
+// 可以在Sandbox中开放的库名称。其中 base 为Lua基础函数，http 为预加载的HTTP模块。
+const (
+	SandboxLibPackage = "package"
+	SandboxLibBase    = "base"
+	SandboxLibTable   = "table"
+	SandboxLibIo      = "io"
+	SandboxLibOs      = "os"
+	SandboxLibString  = "string"
+	SandboxLibMath    = "math"
+	SandboxLibHttp    = "http"
+)
+
+// 默认开放的安全库。package、io、os和http需要在sandbox参数的libs中显式开放；
+// 未开放package库时，仍可以require预加载的gecko模块。
+var defaultSandboxLibs = []string{SandboxLibBase, SandboxLibTable, SandboxLibString, SandboxLibMath}
+
+// 脚本Sandbox配置
+type Sandbox struct {
+	// 开放的库名称白名单
+	Libs []string
+	// 文件系统根目录；脚本只能访问此目录内的文件。
+	// 为空时禁止脚本使用dofile/loadfile加载文件，显式开放的io、os库不限制访问路径
+	FsRoot string
+	// 每次脚本调用的执行时间限制；为0时不限制
+	Timeout time.Duration
+	// 调用栈大小
+	CallStackSize int
+	// 数据栈大小
+	RegistrySize int
+	// 不限制文件访问，仅用于 NewLuaEngine
+	unrestricted bool
+}
+
+// 未配置sandbox参数时的默认设置：只开放安全库
+func defaultSandbox() *Sandbox {
+	return &Sandbox{
+		Libs:          defaultSandboxLibs,
+		CallStackSize: defaultCallStackSize,
+		RegistrySize:  glua.RegistrySize,
+	}
+}
+
+// 开放全部库且不限制文件系统，与 NewLuaEngine 保持一致
+func unrestrictedSandbox() *Sandbox {
+	return &Sandbox{
+		Libs:          []string{SandboxLibPackage, SandboxLibBase, SandboxLibTable, SandboxLibIo, SandboxLibOs, SandboxLibString, SandboxLibMath, SandboxLibHttp},
+		CallStackSize: defaultCallStackSize,
+		RegistrySize:  glua.RegistrySize,
+		unrestricted:  true,
+	}
+}
+
+// 从组件InitArgs的sandbox参数读取Sandbox配置，例如：
+//
+//	[DRIVERS.ScriptDriver.InitArgs.sandbox]
+//	  libs = ["base", "table", "string", "math", "io"]
+//	  fsRoot = "/var/gecko/data"
+//	  timeout = "500ms"
+//	  callStackSize = 64
+//	  registrySize = 10240
+func sandboxOf(args map[string]interface{}) (*Sandbox, error) {
+	v, ok := args["sandbox"]
+	if !ok {
+		return defaultSandbox(), nil
+	}
+	config := utils.ToMap(v)
+	sb := &Sandbox{
+		Libs:          defaultSandboxLibs,
+		FsRoot:        value.Of(config["fsRoot"]).String(),
+		Timeout:       value.Of(config["timeout"]).DurationOfDefault(0),
+		CallStackSize: int(value.Of(config["callStackSize"]).Int64OrDefault(defaultCallStackSize)),
+		RegistrySize:  int(value.Of(config["registrySize"]).Int64OrDefault(int64(glua.RegistrySize))),
+	}
+	if libs, ok := config["libs"]; ok {
+		sb.Libs = utils.ToStringArray(libs)
+	}
+	for _, lib := range sb.Libs {
+		if !isKnownLib(lib) {
+			return nil, errors.Errorf("sandbox: unknown lib: %s", lib)
+		}
+	}
+	if "" != sb.FsRoot {
+		root, err := filepath.Abs(sb.FsRoot)
+		if nil != err {
+			return nil, errors.Wrap(err, "sandbox: invalid fsRoot")
+		}
+		// 根目录本身是符号链接时，使用链接目标作为根目录
+		if real, err := filepath.EvalSymlinks(root); nil == err {
+			root = real
+		}
+		sb.FsRoot = root
+	}
+	if sb.CallStackSize <= 0 || sb.RegistrySize <= 0 {
+		return nil, errors.New("sandbox: callStackSize and registrySize must be positive")
+	}
+	return sb, nil
+}
+
+func isKnownLib(name string) bool {
+	if SandboxLibHttp == name {
+		return true
+	}
+	for _, lib := range luaLibs {
+		if lib.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (sb *Sandbox) allows(lib string) bool {
+	for _, l := range sb.Libs {
+		if l == lib {
+			return true
+		}
+	}
+	return false
+}
+
+// 创建符合Sandbox配置的LState
+func newSandboxEngine(sb *Sandbox) *glua.LState {
+	ls := glua.NewState(glua.Options{
+		CallStackSize: sb.CallStackSize,
+		RegistrySize:  sb.RegistrySize,
+		SkipOpenLibs:  true,
+	})
+	for _, lib := range luaLibs {
+		if sb.allows(lib.name) {
+			ls.Push(ls.NewFunction(lib.libFunc))
+			ls.Push(glua.LString(lib.libName))
+			ls.Call(1, 0)
+		}
+	}
+	// 未开放package库时，只保留预加载模块的加载器：脚本可以require内置的gecko、http模块，但不能从文件系统加载模块
+	if !sb.allows(SandboxLibPackage) {
+		openPreloadPackage(ls)
+	}
+	if sb.allows(SandboxLibHttp) {
+		preloadHttp(ls)
+	}
+	if "" != sb.FsRoot {
+		restrictFs(ls, sb.FsRoot)
+	} else if !sb.unrestricted {
+		globals := ls.Get(glua.GlobalsIndex)
+		denyFn(ls, globals, "dofile")
+		denyFn(ls, globals, "loadfile")
+	}
+	return ls
+}
+
+// 打开只支持预加载模块的package库
+func openPreloadPackage(ls *glua.LState) {
+	ls.Push(ls.NewFunction(glua.OpenPackage))
+	ls.Push(glua.LString(LoadLibName))
+	ls.Call(1, 0)
+	pkg := ls.GetGlobal(LoadLibName).(*glua.LTable)
+	if loaders, ok := pkg.RawGetString("loaders").(*glua.LTable); ok {
+		// 第一个加载器为预加载模块加载器，移除其后的文件加载器
+		for i := loaders.Len(); i > 1; i-- {
+			loaders.RawSetInt(i, glua.LNil)
+		}
+	}
+	pkg.RawSetString("path", glua.LString(""))
+	pkg.RawSetString("cpath", glua.LString(""))
+	pkg.RawSetString("loadlib", glua.LNil)
+	pkg.RawSetString("seeall", glua.LNil)
+}
+
+// 将函数替换为总是返回ErrScriptFsDenied错误的函数
+func denyFn(ls *glua.LState, table glua.LValue, name string) {
+	if tb, ok := table.(*glua.LTable); ok && glua.LNil != tb.RawGetString(name) {
+		tb.RawSetString(name, ls.NewFunction(func(L *glua.LState) int {
+			L.RaiseError("%s: %s", ErrScriptFsDenied.Error(), name)
+			return 0
+		}))
+	}
+}
+
+// 限制文件访问函数只能访问根目录内的文件
+func restrictFs(ls *glua.LState, root string) {
+	// optional 为true时，路径参数可以为空或者文件对象，例如 io.lines()、io.output(file)
+	wrap := func(table glua.LValue, name string, optional bool, pathArgs ...int) {
+		tb, ok := table.(*glua.LTable)
+		if !ok {
+			return
+		}
+		origin, ok := tb.RawGetString(name).(*glua.LFunction)
+		if !ok {
+			return
+		}
+		tb.RawSetString(name, ls.NewFunction(func(L *glua.LState) int {
+			for _, idx := range pathArgs {
+				if optional {
+					if _, isFile := L.Get(idx).(*glua.LUserData); isFile || glua.LNil == L.Get(idx) {
+						continue
+					}
+				}
+				path, err := resolveSandboxPath(root, L.CheckString(idx))
+				if nil != err {
+					L.RaiseError("%s", err.Error())
+					return 0
+				}
+				L.Replace(idx, glua.LString(path))
+			}
+			return origin.GFunction(L)
+		}))
+	}
+	globals := ls.Get(glua.GlobalsIndex)
+	wrap(globals, "dofile", false, 1)
+	wrap(globals, "loadfile", false, 1)
+	ioLib := ls.GetGlobal(IoLibName)
+	wrap(ioLib, "open", false, 1)
+	wrap(ioLib, "lines", true, 1)
+	wrap(ioLib, "input", true, 1)
+	wrap(ioLib, "output", true, 1)
+	denyFn(ls, ioLib, "popen")
+	osLib := ls.GetGlobal(OsLibName)
+	wrap(osLib, "remove", false, 1)
+	wrap(osLib, "rename", false, 1, 2)
+	denyFn(ls, osLib, "execute")
+	denyFn(ls, osLib, "exit")
+	denyFn(ls, osLib, "tmpname")
+	// require只能加载根目录内的模块
+	if pkg, ok := ls.GetGlobal(LoadLibName).(*glua.LTable); ok {
+		pkg.RawSetString("path", glua.LString(filepath.Join(root, "?.lua")))
+	}
+}
+
+// 将脚本访问的路径转换为根目录内的绝对路径；越过根目录时返回错误。
+// 路径中的符号链接会被解析，根目录内指向根目录之外的链接同样被拒绝。
+func resolveSandboxPath(root string, path string) (string, error) {
+	var abs string
+	if filepath.IsAbs(path) {
+		abs = filepath.Clean(path)
+	} else {
+		abs = filepath.Join(root, path)
+	}
+	if !isWithinRoot(root, abs) {
+		return "", errors.Wrap(ErrScriptFsDenied, path)
+	}
+	real, err := evalSandboxSymlinks(abs)
+	if nil != err || !isWithinRoot(root, real) {
+		return "", errors.Wrap(ErrScriptFsDenied, path)
+	}
+	return real, nil
+}
+
+// 判断路径是否在根目录内；root为已清理的绝对路径
+func isWithinRoot(root string, path string) bool {
+	if path == root {
+		return true
+	}
+	prefix := root
+	if !strings.HasSuffix(prefix, string(filepath.Separator)) {
+		prefix += string(filepath.Separator)
+	}
+	return strings.HasPrefix(path, prefix)
+}
+
+// 解析路径中的符号链接。文件不存在时（例如新建文件），解析其上级目录后拼接文件名；
+// 路径本身是指向不存在目标的符号链接时返回错误，避免通过链接在根目录之外创建文件。
+func evalSandboxSymlinks(path string) (string, error) {
+	real, err := filepath.EvalSymlinks(path)
+	if nil == err {
+		return real, nil
+	}
+	if !os.IsNotExist(err) {
+		return "", err
+	}
+	if _, lerr := os.Lstat(path); nil == lerr {
+		return "", err
+	}
+	parent := filepath.Dir(path)
+	if parent == path {
+		return "", err
+	}
+	realParent, err := evalSandboxSymlinks(parent)
+	if nil != err {
+		return "", err
+	}
+	return filepath.Join(realParent, filepath.Base(path)), nil
+}
+
+// 在Sandbox限制下调用栈中的函数
+func (sb *Sandbox) pcall(L *glua.LState, nArgs int, nRets int) error {
+	if sb.Timeout > 0 {
+		ctx, cancel := context.WithTimeout(context.Background(), sb.Timeout)
+		defer cancel()
+		L.SetContext(ctx)
+		defer L.RemoveContext()
+		if err := L.PCall(nArgs, nRets, nil); nil != err {
+			if context.DeadlineExceeded == ctx.Err() {
+				return errors.Wrapf(ErrScriptTimeout, "timeout: %s", sb.Timeout)
+			}
+			return sandboxError(err)
+		}
+		return nil
+	}
+	return sandboxError(L.PCall(nArgs, nRets, nil))
+}
+
+func sandboxError(err error) error {
+	if nil == err {
+		return nil
+	}
+	msg := err.Error()
+	if strings.Contains(msg, "stack overflow") || strings.Contains(msg, "index out of range") {
+		return errors.Wrap(ErrScriptLimit, msg)
+	}
+	return err
+}
@@ -0,0 +1,222 @@
+package lua
+
+import (
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/yuin/gopher-lua"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func callSandbox(sb *Sandbox, script string, fn string) error {
+	L := newSandboxEngine(sb)
+	defer L.Close()
+	if err := L.DoString(script); nil != err {
+		return err
+	}
+	L.Push(L.GetGlobal(fn))
+	return sb.pcall(L, 0, lua.MultRet)
+}
+
+func TestSandboxOfDefaults(t *testing.T) {
+	// 未配置sandbox参数时只开放安全库
+	sb, err := sandboxOf(map[string]interface{}{})
+	assert.NoError(t, err)
+	assert.False(t, sb.allows(SandboxLibIo))
+	assert.False(t, sb.allows(SandboxLibOs))
+	assert.False(t, sb.allows(SandboxLibHttp))
+	assert.False(t, sb.allows(SandboxLibPackage))
+	assert.True(t, sb.allows(SandboxLibBase))
+	assert.Equal(t, time.Duration(0), sb.Timeout)
+
+	sb, err = sandboxOf(map[string]interface{}{
+		"sandbox": map[string]interface{}{
+			"timeout":       "100ms",
+			"callStackSize": int64(32),
+		},
+	})
+	assert.NoError(t, err)
+	assert.False(t, sb.allows(SandboxLibIo))
+	assert.False(t, sb.allows(SandboxLibOs))
+	assert.False(t, sb.allows(SandboxLibHttp))
+	assert.True(t, sb.allows(SandboxLibString))
+	assert.Equal(t, 100*time.Millisecond, sb.Timeout)
+	assert.Equal(t, 32, sb.CallStackSize)
+
+	_, err = sandboxOf(map[string]interface{}{
+		"sandbox": map[string]interface{}{"libs": []interface{}{"base", "debug"}},
+	})
+	assert.Error(t, err)
+}
+
+func TestSandboxLibsWhitelist(t *testing.T) {
+	sb, err := sandboxOf(map[string]interface{}{"sandbox": map[string]interface{}{}})
+	assert.NoError(t, err)
+	L := newSandboxEngine(sb)
+	defer L.Close()
+	assert.Equal(t, lua.LNil, L.GetGlobal(IoLibName))
+	assert.Equal(t, lua.LNil, L.GetGlobal(OsLibName))
+	assert.NotEqual(t, lua.LNil, L.GetGlobal(StringLibName))
+}
+
+func TestSandboxDefaultPackagePreloadOnly(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gecko-sandbox")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "mod.lua"), []byte("return {}"), 0644))
+
+	L := newSandboxEngine(defaultSandbox())
+	defer L.Close()
+	L.PreloadModule("builtin", func(L *lua.LState) int {
+		L.Push(L.NewTable())
+		return 1
+	})
+	assert.NoError(t, L.DoString(`assert(require("builtin") ~= nil)`))
+	assert.NoError(t, L.DoString(`assert(package.loadlib == nil)`))
+	assert.Error(t, L.DoString(`package.path = "`+filepath.Join(dir, "?.lua")+`"; require("mod")`))
+	assert.Equal(t, lua.LNil, L.GetGlobal(IoLibName))
+}
+
+// 未配置fsRoot时，脚本不能通过dofile/loadfile加载文件
+func TestSandboxDenyFileLoadWithoutFsRoot(t *testing.T) {
+	script := writeTestScript(t, `loaded = true`)
+	defer os.Remove(script)
+
+	for _, fn := range []string{"dofile", "loadfile"} {
+		err := callSandbox(defaultSandbox(), `function main() `+fn+`("`+script+`") end`, "main")
+		assert.Error(t, err, fn)
+		assert.Contains(t, err.Error(), ErrScriptFsDenied.Error(), fn)
+	}
+
+	L := NewLuaEngine()
+	defer L.Close()
+	assert.NoError(t, L.DoString(`dofile("`+script+`")`))
+	assert.Equal(t, lua.LTrue, L.GetGlobal("loaded"))
+}
+
+func TestSandboxTimeout(t *testing.T) {
+	sb := defaultSandbox()
+	sb.Timeout = 50 * time.Millisecond
+	start := time.Now()
+	err := callSandbox(sb, `function main() while true do end end`, "main")
+	assert.Equal(t, ErrScriptTimeout, errors.Cause(err))
+	assert.True(t, time.Since(start) < time.Second)
+}
+
+func TestSandboxStackLimit(t *testing.T) {
+	sb := defaultSandbox()
+	sb.CallStackSize = 16
+	err := callSandbox(sb, `function f(n) return f(n + 1) + 1 end function main() return f(1) end`, "main")
+	assert.Equal(t, ErrScriptLimit, errors.Cause(err))
+}
+
+func TestSandboxFsRoot(t *testing.T) {
+	root, err := ioutil.TempDir("", "gecko-sandbox")
+	assert.NoError(t, err)
+	defer os.RemoveAll(root)
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(root, "data.txt"), []byte("hello"), 0644))
+
+	sb, err := sandboxOf(map[string]interface{}{
+		"sandbox": map[string]interface{}{
+			"libs":   []interface{}{"base", "io", "os"},
+			"fsRoot": root,
+		},
+	})
+	assert.NoError(t, err)
+
+	err = callSandbox(sb, `function main()
+		local f = assert(io.open("data.txt", "r"))
+		local text = f:read("*a")
+		f:close()
+		assert(text == "hello")
+	end`, "main")
+	assert.NoError(t, err)
+
+	// 缺少路径参数或者参数不是字符串时不调用原函数
+	for _, script := range []string{
+		`function main() dofile() end`,
+		`function main() io.open(123) end`,
+		`function main() loadfile() end`,
+		`function main() io.open() end`,
+		`function main() os.remove() end`,
+	} {
+		assert.Error(t, callSandbox(sb, script, "main"), script)
+	}
+
+	for _, script := range []string{
+		`function main() io.open("../passwd", "r") end`,
+		`function main() io.open("/etc/passwd", "r") end`,
+		`function main() dofile("/etc/profile") end`,
+		`function main() os.execute("ls") end`,
+	} {
+		err := callSandbox(sb, script, "main")
+		assert.Error(t, err, script)
+		assert.Contains(t, err.Error(), ErrScriptFsDenied.Error(), script)
+	}
+}
+
+func TestResolveSandboxPath(t *testing.T) {
+	base, err := ioutil.TempDir("", "gecko-sandbox")
+	assert.NoError(t, err)
+	defer os.RemoveAll(base)
+	base, err = filepath.EvalSymlinks(base)
+	assert.NoError(t, err)
+	root := filepath.Join(base, "root")
+	outside := filepath.Join(base, "outside")
+	assert.NoError(t, os.Mkdir(root, 0755))
+	assert.NoError(t, os.Mkdir(outside, 0755))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(outside, "secret.txt"), []byte("secret"), 0644))
+	assert.NoError(t, os.Mkdir(filepath.Join(root, "data"), 0755))
+	assert.NoError(t, os.Symlink(outside, filepath.Join(root, "escape")))
+	assert.NoError(t, os.Symlink(filepath.Join(outside, "missing.txt"), filepath.Join(root, "dangling")))
+	assert.NoError(t, os.Symlink(filepath.Join(root, "data"), filepath.Join(root, "inner")))
+
+	path, err := resolveSandboxPath(root, "data/new.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(root, "data", "new.txt"), path)
+	path, err = resolveSandboxPath(root, "inner/new.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(root, "data", "new.txt"), path)
+
+	for _, p := range []string{"../outside/secret.txt", "escape/secret.txt", "escape/new.txt", "dangling"} {
+		_, err := resolveSandboxPath(root, p)
+		assert.Equal(t, ErrScriptFsDenied, errors.Cause(err), p)
+	}
+
+	// 根目录为"/"时允许访问任意绝对路径
+	path, err = resolveSandboxPath("/", filepath.Join(outside, "secret.txt"))
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(outside, "secret.txt"), path)
+	sb, err := sandboxOf(map[string]interface{}{"sandbox": map[string]interface{}{"fsRoot": "/"}})
+	assert.NoError(t, err)
+	assert.Equal(t, "/", sb.FsRoot)
+}
+
+func TestLStatePoolSandboxTimeout(t *testing.T) {
+	script := writeTestScript(t, `function spin() while true do end end`)
+	defer os.Remove(script)
+
+	config := lStatePoolConfigOf(map[string]interface{}{
+		"sandbox": map[string]interface{}{"timeout": "30ms"},
+	}, nil)
+	pool, err := newLStatePool(script, config)
+	assert.NoError(t, err)
+	defer pool.close()
+	L, err := pool.get()
+	assert.NoError(t, err)
+	L.Push(L.GetGlobal("spin"))
+	assert.Equal(t, ErrScriptTimeout, errors.Cause(pool.call(L, 0, 0)))
+	pool.put(L)
+
+	// 超时后LState仍然可以继续使用
+	L, err = pool.get()
+	assert.NoError(t, err)
+	L.Push(L.GetGlobal("tostring"))
+	L.Push(lua.LNumber(1))
+	assert.NoError(t, pool.call(L, 1, 1))
+	assert.Equal(t, "1", L.Get(-1).String())
+	pool.put(L)
+}
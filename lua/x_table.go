@@ -1,80 +1,419 @@
 package lua
 
 import (
+	"github.com/pkg/errors"
 	"github.com/yuin/gopher-lua"
+	"reflect"
+	"strconv"
+	"strings"
 	"time"
 )
 
+// Go与Lua数据类型转换。
+// Go -> Lua：
+//   nil、nil指针 -> nil；bool -> boolean；string、[]byte -> string；
+//   全部整数和浮点数类型 -> number；time.Time -> Unix秒数；time.Duration -> 毫秒数；
+//   Slice、Array -> 数组Table（nil元素保留位置）；Map -> Table（Key转换为string或者number）；
+//   Struct -> Table，字段名使用json标签或者字段名；指针和interface取其指向的值；
+//   func、chan等不支持的类型 -> nil。
+// Lua -> Go：
+//   nil -> nil；boolean -> bool；number -> float64；string -> string；
+//   连续整数Key(1..n)的Table -> []interface{}，其它Table -> map[string]interface{}；UserData -> 其Value值。
+//   包含循环引用的Table无法转换，返回错误。
+// LValueInto 按目标Go类型转换Lua数据，支持整数、浮点数、字符串、Slice、Map、Struct和time.Duration等类型。
+
+var errLTableCycle = errors.New("cannot convert lua table with reference cycle")
+
+var (
+	typeTime     = reflect.TypeOf(time.Time{})
+	typeDuration = reflect.TypeOf(time.Duration(0))
+)
+
 // mapToLTable converts a Go map to a lua table
 func mapToLTable(m map[string]interface{}) *lua.LTable {
-	// Main table pointer
 	out := &lua.LTable{}
-
-	// Loop map
 	for key, val := range m {
+		if lv := GoToLValue(val); lua.LNil != lv {
+			out.RawSetString(key, lv)
+		}
+	}
+	return out
+}
+
+// GoToLValue converts a Go value to a lua value. Unsupported types are converted to nil.
+func GoToLValue(val interface{}) lua.LValue {
+	switch v := val.(type) {
+	case nil:
+		return lua.LNil
+	case lua.LValue:
+		return v
+	case string:
+		return lua.LString(v)
+	case bool:
+		return lua.LBool(v)
+	case float64:
+		return lua.LNumber(v)
+	case int64:
+		return lua.LNumber(v)
+	case []byte:
+		return lua.LString(string(v))
+	case time.Time:
+		return lua.LNumber(v.Unix())
+	case time.Duration:
+		return lua.LNumber(float64(v) / float64(time.Millisecond))
+	case map[string]interface{}:
+		return mapToLTable(v)
+	}
+	return reflectToLValue(reflect.ValueOf(val))
+}
 
-		switch val.(type) {
-		case float64:
-			out.RawSetString(key, lua.LNumber(val.(float64)))
-		case int64:
-			out.RawSetString(key, lua.LNumber(val.(int64)))
-		case string:
-			out.RawSetString(key, lua.LString(val.(string)))
-		case bool:
-			out.RawSetString(key, lua.LBool(val.(bool)))
-		case []byte:
-			out.RawSetString(key, lua.LString(string(val.([]byte))))
-		case map[string]interface{}:
-			// Get table from map
-			t := mapToLTable(val.(map[string]interface{}))
-			out.RawSetString(key, t)
-
-		case time.Time:
-			out.RawSetString(key, lua.LNumber(val.(time.Time).Unix()))
-
-		case []map[string]interface{}:
-			// Create slice table
-			array := &lua.LTable{}
-			// Loop val
-			for _, s := range val.([]map[string]interface{}) {
-				// Get table from map
-				t := mapToLTable(s)
-				array.Append(t)
+func reflectToLValue(rv reflect.Value) lua.LValue {
+	switch rv.Kind() {
+	case reflect.Invalid:
+		return lua.LNil
+	case reflect.Ptr, reflect.Interface:
+		if rv.IsNil() {
+			return lua.LNil
+		}
+		return GoToLValue(rv.Elem().Interface())
+	case reflect.Bool:
+		return lua.LBool(rv.Bool())
+	case reflect.String:
+		return lua.LString(rv.String())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if rv.Type() == typeDuration {
+			return lua.LNumber(float64(rv.Int()) / float64(time.Millisecond))
+		}
+		return lua.LNumber(rv.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return lua.LNumber(rv.Uint())
+	case reflect.Float32, reflect.Float64:
+		return lua.LNumber(rv.Float())
+	case reflect.Slice, reflect.Array:
+		if rv.Kind() == reflect.Slice && rv.IsNil() {
+			return lua.LNil
+		}
+		if rv.Type().Elem().Kind() == reflect.Uint8 {
+			bytes := make([]byte, rv.Len())
+			reflect.Copy(reflect.ValueOf(bytes), rv)
+			return lua.LString(string(bytes))
+		}
+		array := &lua.LTable{}
+		for i := 0; i < rv.Len(); i++ {
+			array.RawSetInt(i+1, GoToLValue(rv.Index(i).Interface()))
+		}
+		return array
+	case reflect.Map:
+		if rv.IsNil() {
+			return lua.LNil
+		}
+		table := &lua.LTable{}
+		iter := rv.MapRange()
+		for iter.Next() {
+			key := GoToLValue(iter.Key().Interface())
+			if lua.LNil == key {
+				continue
 			}
-			// Set slice table
-			out.RawSetString(key, array)
-
-		case []interface{}:
-			// Create slice table
-			array := &lua.LTable{}
-			// Loop interface slice
-			for _, s := range val.([]interface{}) {
-				// Switch interface type
-				switch s.(type) {
-				case map[string]interface{}:
-					// Convert map to table
-					t := mapToLTable(s.(map[string]interface{}))
-					// Append result
-					array.Append(t)
-
-				case float64:
-					// Append result as number
-					array.Append(lua.LNumber(s.(float64)))
-
-				case string:
-					// Append result as string
-					array.Append(lua.LString(s.(string)))
-
-				case bool:
-					// Append result as bool
-					array.Append(lua.LBool(s.(bool)))
-				}
+			if lv := GoToLValue(iter.Value().Interface()); lua.LNil != lv {
+				table.RawSet(key, lv)
+			}
+		}
+		return table
+	case reflect.Struct:
+		if rv.Type() == typeTime {
+			return lua.LNumber(rv.Interface().(time.Time).Unix())
+		}
+		table := &lua.LTable{}
+		rt := rv.Type()
+		for i := 0; i < rt.NumField(); i++ {
+			name, ok := luaFieldName(rt.Field(i))
+			if !ok {
+				continue
 			}
+			if lv := GoToLValue(rv.Field(i).Interface()); lua.LNil != lv {
+				table.RawSetString(name, lv)
+			}
+		}
+		return table
+	default:
+		return lua.LNil
+	}
+}
+
+// 返回Struct字段在Lua Table中的名称：优先使用json标签；非公开字段和 `json:"-"` 字段被忽略
+func luaFieldName(field reflect.StructField) (string, bool) {
+	if "" != field.PkgPath {
+		return "", false
+	}
+	tag := field.Tag.Get("json")
+	if "-" == tag {
+		return "", false
+	}
+	if name := strings.Split(tag, ",")[0]; "" != name {
+		return name, true
+	}
+	return field.Name, true
+}
+
+// lTableToMap converts a lua table to a Go map. Nested tables are converted recursively.
+// Returns an error if the table contains a reference cycle.
+func lTableToMap(table *lua.LTable) (map[string]interface{}, error) {
+	if nil == table {
+		return make(map[string]interface{}), nil
+	}
+	return lTableEntriesToGo(table, map[*lua.LTable]bool{table: true})
+}
+
+// LValueToGo converts a lua value to a Go value.
+// Tables with only sequence keys 1..n are converted to []interface{}, others to map[string]interface{}.
+// Returns an error if the value contains a table reference cycle.
+func LValueToGo(val lua.LValue) (interface{}, error) {
+	return lValueToGo(val, make(map[*lua.LTable]bool))
+}
 
-			// Append to main table
-			out.RawSetString(key, array)
+// visiting 记录当前转换路径上的Table，用于检测循环引用
+func lValueToGo(val lua.LValue, visiting map[*lua.LTable]bool) (interface{}, error) {
+	switch v := val.(type) {
+	case lua.LNumber:
+		return float64(v), nil
+	case lua.LString:
+		return string(v), nil
+	case lua.LBool:
+		return bool(v), nil
+	case *lua.LTable:
+		if visiting[v] {
+			return nil, errLTableCycle
 		}
+		visiting[v] = true
+		defer delete(visiting, v)
+		if isLArray(v) {
+			array := make([]interface{}, v.Len())
+			var err error
+			v.ForEach(func(key lua.LValue, item lua.LValue) {
+				if nil == err {
+					array[int(key.(lua.LNumber))-1], err = lValueToGo(item, visiting)
+				}
+			})
+			return array, err
+		}
+		return lTableEntriesToGo(v, visiting)
+	case *lua.LUserData:
+		return v.Value, nil
+	default:
+		return nil, nil
 	}
+}
 
-	return out
+func lTableEntriesToGo(table *lua.LTable, visiting map[*lua.LTable]bool) (map[string]interface{}, error) {
+	out := make(map[string]interface{})
+	var err error
+	table.ForEach(func(key lua.LValue, val lua.LValue) {
+		if nil != err {
+			return
+		}
+		var v interface{}
+		if v, err = lValueToGo(val, visiting); nil == err && nil != v {
+			out[key.String()] = v
+		}
+	})
+	if nil != err {
+		return nil, err
+	}
+	return out, nil
+}
+
+// isLArray checks if the table is a non-empty sequence.
+func isLArray(table *lua.LTable) bool {
+	size := table.Len()
+	if 0 == size {
+		return false
+	}
+	count := 0
+	isArray := true
+	table.ForEach(func(key lua.LValue, _ lua.LValue) {
+		count++
+		if n, ok := key.(lua.LNumber); !ok || n < 1 || int(n) > size || float64(n) != float64(int(n)) {
+			isArray = false
+		}
+	})
+	return isArray && count == size
+}
+
+////
+
+// LValueInto 将Lua数据转换为ptr指向的Go类型，ptr必须为非nil指针。
+func LValueInto(val lua.LValue, ptr interface{}) error {
+	rv := reflect.ValueOf(ptr)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return errors.New("LValueInto: target must be a non-nil pointer")
+	}
+	return lValueInto(val, rv.Elem(), "", make(map[*lua.LTable]bool))
+}
+
+func lValueInto(val lua.LValue, out reflect.Value, path string, visiting map[*lua.LTable]bool) error {
+	mismatch := func() error {
+		return errors.Errorf("cannot convert lua %s to %s at %q", val.Type().String(), out.Type().String(), path)
+	}
+	if lua.LNil == val {
+		out.Set(reflect.Zero(out.Type()))
+		return nil
+	}
+	switch out.Kind() {
+	case reflect.Interface:
+		v, err := lValueToGo(val, visiting)
+		if nil != err {
+			return errors.Wrapf(err, "at %q", path)
+		}
+		if nil != v {
+			rv := reflect.ValueOf(v)
+			if !rv.Type().AssignableTo(out.Type()) {
+				return mismatch()
+			}
+			out.Set(rv)
+		}
+		return nil
+	case reflect.Ptr:
+		elem := reflect.New(out.Type().Elem())
+		if err := lValueInto(val, elem.Elem(), path, visiting); nil != err {
+			return err
+		}
+		out.Set(elem)
+		return nil
+	case reflect.Bool:
+		b, ok := val.(lua.LBool)
+		if !ok {
+			return mismatch()
+		}
+		out.SetBool(bool(b))
+	case reflect.String:
+		switch v := val.(type) {
+		case lua.LString:
+			out.SetString(string(v))
+		case lua.LNumber:
+			out.SetString(v.String())
+		default:
+			return mismatch()
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if out.Type() == typeDuration {
+			if s, ok := val.(lua.LString); ok {
+				d, err := time.ParseDuration(string(s))
+				if nil != err {
+					return errors.Wrapf(err, "invalid duration at %q", path)
+				}
+				out.SetInt(int64(d))
+				return nil
+			}
+			n, ok := lNumberOf(val)
+			if !ok {
+				return mismatch()
+			}
+			out.SetInt(int64(n * float64(time.Millisecond)))
+			return nil
+		}
+		n, ok := lNumberOf(val)
+		if !ok || n != float64(int64(n)) || out.OverflowInt(int64(n)) {
+			return mismatch()
+		}
+		out.SetInt(int64(n))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		n, ok := lNumberOf(val)
+		if !ok || n < 0 || n != float64(uint64(n)) || out.OverflowUint(uint64(n)) {
+			return mismatch()
+		}
+		out.SetUint(uint64(n))
+	case reflect.Float32, reflect.Float64:
+		n, ok := lNumberOf(val)
+		if !ok {
+			return mismatch()
+		}
+		out.SetFloat(n)
+	case reflect.Slice:
+		if s, ok := val.(lua.LString); ok && out.Type().Elem().Kind() == reflect.Uint8 {
+			out.SetBytes([]byte(string(s)))
+			return nil
+		}
+		table, ok := val.(*lua.LTable)
+		if !ok {
+			return mismatch()
+		}
+		if visiting[table] {
+			return errors.Wrapf(errLTableCycle, "at %q", path)
+		}
+		visiting[table] = true
+		defer delete(visiting, table)
+		size := table.Len()
+		slice := reflect.MakeSlice(out.Type(), size, size)
+		for i := 0; i < size; i++ {
+			if err := lValueInto(table.RawGetInt(i+1), slice.Index(i), path+"["+strconv.Itoa(i)+"]", visiting); nil != err {
+				return err
+			}
+		}
+		out.Set(slice)
+	case reflect.Map:
+		table, ok := val.(*lua.LTable)
+		if !ok {
+			return mismatch()
+		}
+		if visiting[table] {
+			return errors.Wrapf(errLTableCycle, "at %q", path)
+		}
+		visiting[table] = true
+		defer delete(visiting, table)
+		m := reflect.MakeMap(out.Type())
+		var err error
+		table.ForEach(func(k lua.LValue, v lua.LValue) {
+			if nil != err {
+				return
+			}
+			key := reflect.New(out.Type().Key()).Elem()
+			if err = lValueInto(k, key, path, visiting); nil != err {
+				return
+			}
+			item := reflect.New(out.Type().Elem()).Elem()
+			if err = lValueInto(v, item, path+"."+k.String(), visiting); nil != err {
+				return
+			}
+			m.SetMapIndex(key, item)
+		})
+		if nil != err {
+			return err
+		}
+		out.Set(m)
+	case reflect.Struct:
+		table, ok := val.(*lua.LTable)
+		if !ok {
+			return mismatch()
+		}
+		if visiting[table] {
+			return errors.Wrapf(errLTableCycle, "at %q", path)
+		}
+		visiting[table] = true
+		defer delete(visiting, table)
+		rt := out.Type()
+		for i := 0; i < rt.NumField(); i++ {
+			name, ok := luaFieldName(rt.Field(i))
+			if !ok {
+				continue
+			}
+			if err := lValueInto(table.RawGetString(name), out.Field(i), path+"."+name, visiting); nil != err {
+				return err
+			}
+		}
+	default:
+		return mismatch()
+	}
+	return nil
+}
+
+func lNumberOf(val lua.LValue) (float64, bool) {
+	switch v := val.(type) {
+	case lua.LNumber:
+		return float64(v), true
+	case lua.LString:
+		f, err := strconv.ParseFloat(strings.TrimSpace(string(v)), 64)
+		return f, nil == err
+	default:
+		return 0, false
+	}
 }
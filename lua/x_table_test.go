@@ -0,0 +1,129 @@
+package lua
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/yuin/gopher-lua"
+	"testing"
+	"time"
+)
+
+type testReaderConfig struct {
+	Name    string        `json:"name"`
+	Port    uint16        `json:"port"`
+	Tags    []string      `json:"tags,omitempty"`
+	Timeout time.Duration `json:"timeout"`
+	Ignored string        `json:"-"`
+	private int
+}
+
+func TestGoToLValue(t *testing.T) {
+	var nilPtr *testReaderConfig
+	cases := []struct {
+		name   string
+		input  interface{}
+		expect interface{}
+	}{
+		{"nil", nil, nil},
+		{"int", 12, float64(12)},
+		{"int32", int32(-3), float64(-3)},
+		{"uint8", uint8(255), float64(255)},
+		{"uint64", uint64(1 << 40), float64(1 << 40)},
+		{"float32", float32(1.5), float64(1.5)},
+		{"bytes", []byte("abc"), "abc"},
+		{"duration", 1500 * time.Millisecond, float64(1500)},
+		{"time", time.Unix(1600000000, 0), float64(1600000000)},
+		{"strings", []string{"a", "b"}, []interface{}{"a", "b"}},
+		{"int64s", []int64{1, 2, 3}, []interface{}{float64(1), float64(2), float64(3)}},
+		{"nil pointer", nilPtr, nil},
+		{"func", func() {}, nil},
+		{"toml map", map[interface{}]interface{}{
+			"reader": map[interface{}]interface{}{"ports": []interface{}{int64(1), int64(2)}},
+		}, map[string]interface{}{
+			"reader": map[string]interface{}{"ports": []interface{}{float64(1), float64(2)}},
+		}},
+		{"struct", &testReaderConfig{Name: "r1", Port: 8080, Timeout: time.Second, Ignored: "x", private: 1},
+			map[string]interface{}{"name": "r1", "port": float64(8080), "timeout": float64(1000)}},
+	}
+	for _, c := range cases {
+		v, err := LValueToGo(GoToLValue(c.input))
+		assert.NoError(t, err, c.name)
+		assert.Equal(t, c.expect, v, c.name)
+	}
+}
+
+func TestLValueToGoCycle(t *testing.T) {
+	L := NewLuaEngine()
+	defer L.Close()
+	preloadGecko(L, nil)
+	assert.NoError(t, L.DoString(`
+shared = { x = 1 }
+value = { a = shared, b = { shared, shared } }
+cyclic = { list = {} }
+cyclic.list[1] = cyclic
+`))
+	// 同一个Table被多次引用不是循环引用
+	v, err := LValueToGo(L.GetGlobal("value"))
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"x": float64(1)}, v.(map[string]interface{})["a"])
+
+	_, err = LValueToGo(L.GetGlobal("cyclic"))
+	assert.Error(t, err)
+	_, err = lTableToMap(L.GetGlobal("cyclic").(*lua.LTable))
+	assert.Error(t, err)
+	var out map[string]interface{}
+	assert.Error(t, LValueInto(L.GetGlobal("cyclic"), &out))
+
+	// 脚本传入循环引用的Table时返回错误，而不是无限递归
+	err = L.DoString(`
+local gecko = require("gecko")
+local t = {}
+t.self = t
+local data, err = gecko.json.encode(t)
+assert(data == nil and err ~= nil)
+gecko.info("cyclic", "value", t)
+`)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "reference cycle")
+}
+
+func TestGoToLValueKeepsNilPosition(t *testing.T) {
+	table := GoToLValue([]interface{}{"a", nil, "c"}).(*lua.LTable)
+	assert.Equal(t, lua.LString("a"), table.RawGetInt(1))
+	assert.Equal(t, lua.LNil, table.RawGetInt(2))
+	assert.Equal(t, lua.LString("c"), table.RawGetInt(3))
+}
+
+func TestLValueInto(t *testing.T) {
+	L := NewLuaEngine()
+	defer L.Close()
+	assert.NoError(t, L.DoString(`
+value = {
+    name = "r1", port = 8080, tags = {"in", "out"}, timeout = "3s",
+    counts = {a = 1, b = 2},
+}`))
+	value := L.GetGlobal("value")
+
+	var config testReaderConfig
+	assert.NoError(t, LValueInto(value, &config))
+	assert.Equal(t, testReaderConfig{Name: "r1", Port: 8080, Tags: []string{"in", "out"}, Timeout: 3 * time.Second}, config)
+
+	var counts map[string]int
+	assert.NoError(t, LValueInto(L.GetField(value, "counts"), &counts))
+	assert.Equal(t, map[string]int{"a": 1, "b": 2}, counts)
+
+	var ints []int
+	assert.NoError(t, LValueInto(GoToLValue([]int{3, 4}), &ints))
+	assert.Equal(t, []int{3, 4}, ints)
+
+	var timeout time.Duration
+	assert.NoError(t, LValueInto(lua.LNumber(250), &timeout))
+	assert.Equal(t, 250*time.Millisecond, timeout)
+
+	var small int8
+	assert.Error(t, LValueInto(lua.LNumber(300), &small))
+	assert.Error(t, LValueInto(lua.LNumber(1.5), &small))
+	var port uint16
+	assert.Error(t, LValueInto(lua.LNumber(-1), &port))
+	assert.Error(t, LValueInto(lua.LString("x"), &config))
+	assert.Error(t, LValueInto(lua.LNumber(1), config))
+}
@@ -0,0 +1,519 @@
+package lua
+
+import (
+	"container/list"
+	"encoding/json"
+	"fmt"
+	"github.com/BurntSushi/toml"
+	"github.com/pkg/errors"
+	"github.com/yoojia/go-gecko/v2"
+	"github.com/yoojia/go-gecko/v2/utils"
+	"github.com/yoojia/go-value"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+//
+// Author: 陈哈哈 chenyongjia@parkingwang.com, yoojiachen@gmail.com
+//
+
+// 脚本测试的组件类型
+const (
+	ScriptTestDriver  = "driver"
+	ScriptTestTrigger = "trigger"
+	ScriptTestOutput  = "output"
+)
+
+// 脚本测试套件。从YAML/TOML/JSON格式的测试用例文件加载，例如（YAML）：
+//
+//	script: ../scripts/driver-sample.lua   # 相对于用例文件的路径
+//	type: driver                           # driver / trigger / output
+//	args: {targetUuid: OUTPUT-1}           # 脚本组件的InitArgs
+//	globals: {region: cn}                  # gecko.globalConfig() 返回的配置；gecko.outputs() 返回全部用例stubs的UUID
+//	cases:
+//	  - name: open door
+//	    topic: /demo/door/1
+//	    uuid: INPUT-1
+//	    attrs: {user: admin}
+//	    vars: {door: "1"}                  # Topic命名通配符捕获的值，即 request.vars
+//	    inbound: {card: "123", frames: "raw"}
+//	    stubs:                             # deliverFn 按目标UUID返回的数据
+//	      OUTPUT-1: {response: {state: ok}, error: ""}
+//	    expect:
+//	      result: {state: ok}              # 返回数据需要包含的字段
+//	      error: ""                        # 错误信息需要包含的文本；为空时不允许返回错误
+//	      delivered: [OUTPUT-1]            # deliverFn 的调用顺序
+//
+// Output类型脚本的 inbound.frames 为输入数据帧，expect.result.frames 为期望的返回数据帧。
+type ScriptTestSuite struct {
+	Script  string
+	Type    string
+	Args    map[string]interface{}
+	Globals map[string]interface{}
+	Cases   []ScriptTestCase
+}
+
+// 脚本测试用例
+type ScriptTestCase struct {
+	Name    string
+	Topic   string
+	Uuid    string
+	Attrs   map[string]interface{}
+	Vars    map[string]string
+	Inbound map[string]interface{}
+	Stubs   map[string]ScriptTestStub
+	Expect  ScriptTestExpect
+}
+
+// 创建测试用例的Session属性
+func (tc ScriptTestCase) attributes() gecko.Attributes {
+	attrs := gecko.NewAttributesWith(tc.Attrs)
+	if len(tc.Vars) > 0 {
+		attrs.Add(gecko.TopicVarsAttrKey, tc.Vars)
+	}
+	return attrs
+}
+
+// deliverFn的桩数据
+type ScriptTestStub struct {
+	Response map[string]interface{}
+	Error    string
+}
+
+// 测试用例的期望结果
+type ScriptTestExpect struct {
+	Result    map[string]interface{}
+	Error     string
+	Delivered []string
+}
+
+// 测试用例的执行结果
+type ScriptTestResult struct {
+	Name     string
+	Failures []string
+}
+
+func (r ScriptTestResult) Passed() bool {
+	return 0 == len(r.Failures)
+}
+
+// 加载测试用例文件，按文件扩展名识别格式：.yaml/.yml，.toml，.json
+func LoadScriptTestSuite(path string) (*ScriptTestSuite, error) {
+	data, err := ioutil.ReadFile(path)
+	if nil != err {
+		return nil, errors.Wrap(err, "读取测试用例文件出错: "+path)
+	}
+	raw := make(map[string]interface{})
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &raw)
+	case ".toml":
+		_, err = toml.Decode(string(data), &raw)
+	case ".json":
+		err = json.Unmarshal(data, &raw)
+	default:
+		return nil, errors.Errorf("不支持的测试用例文件格式: %s", ext)
+	}
+	if nil != err {
+		return nil, errors.Wrap(err, "解析测试用例文件出错: "+path)
+	}
+	suite, err := parseScriptTestSuite(normalizeValue(raw).(map[string]interface{}))
+	if nil != err {
+		return nil, errors.WithMessage(err, path)
+	}
+	if !filepath.IsAbs(suite.Script) {
+		suite.Script = filepath.Join(filepath.Dir(path), suite.Script)
+	}
+	return suite, nil
+}
+
+func parseScriptTestSuite(raw map[string]interface{}) (*ScriptTestSuite, error) {
+	suite := &ScriptTestSuite{
+		Script:  value.Of(raw["script"]).String(),
+		Type:    value.Of(raw["type"]).String(),
+		Args:    utils.ToMap(raw["args"]),
+		Globals: utils.ToMap(raw["globals"]),
+	}
+	if "" == suite.Script {
+		return nil, errors.New("测试用例文件缺少[script]字段")
+	}
+	switch suite.Type {
+	case ScriptTestDriver, ScriptTestTrigger, ScriptTestOutput:
+	default:
+		return nil, errors.Errorf("不支持的脚本类型: %s", suite.Type)
+	}
+	cases, _ := raw["cases"].([]interface{})
+	for i, item := range cases {
+		c := utils.ToMap(item)
+		tc := ScriptTestCase{
+			Name:    value.Of(c["name"]).String(),
+			Topic:   value.Of(c["topic"]).String(),
+			Uuid:    value.Of(c["uuid"]).String(),
+			Attrs:   utils.ToMap(c["attrs"]),
+			Vars:    make(map[string]string),
+			Inbound: utils.ToMap(c["inbound"]),
+			Stubs:   make(map[string]ScriptTestStub),
+		}
+		for k, v := range utils.ToMap(c["vars"]) {
+			tc.Vars[k] = value.Of(v).String()
+		}
+		if "" == tc.Name {
+			tc.Name = fmt.Sprintf("case#%d", i+1)
+		}
+		for uuid, stub := range utils.ToMap(c["stubs"]) {
+			s := utils.ToMap(stub)
+			tc.Stubs[uuid] = ScriptTestStub{
+				Response: utils.ToMap(s["response"]),
+				Error:    value.Of(s["error"]).String(),
+			}
+		}
+		expect := utils.ToMap(c["expect"])
+		tc.Expect = ScriptTestExpect{
+			Result:    utils.ToMap(expect["result"]),
+			Error:     value.Of(expect["error"]).String(),
+			Delivered: utils.ToStringArray(expect["delivered"]),
+		}
+		if _, ok := expect["delivered"]; !ok {
+			tc.Expect.Delivered = nil
+		}
+		suite.Cases = append(suite.Cases, tc)
+	}
+	return suite, nil
+}
+
+// 将YAML解析的 map[interface{}]interface{} 结构转换为 map[string]interface{}
+func normalizeValue(val interface{}) interface{} {
+	switch v := val.(type) {
+	case map[interface{}]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for k, item := range v {
+			out[value.ToString(k)] = normalizeValue(item)
+		}
+		return out
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for k, item := range v {
+			out[k] = normalizeValue(item)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, item := range v {
+			out[i] = normalizeValue(item)
+		}
+		return out
+	case []map[string]interface{}:
+		out := make([]interface{}, len(v))
+		for i, item := range v {
+			out[i] = normalizeValue(item)
+		}
+		return out
+	default:
+		return val
+	}
+}
+
+// 加载并执行测试用例文件
+func RunScriptTestFile(path string) ([]ScriptTestResult, error) {
+	suite, err := LoadScriptTestSuite(path)
+	if nil != err {
+		return nil, err
+	}
+	return RunScriptTestSuite(suite)
+}
+
+// 执行测试套件中的全部用例。脚本加载失败时返回错误。
+func RunScriptTestSuite(suite *ScriptTestSuite) ([]ScriptTestResult, error) {
+	args := make(map[string]interface{}, len(suite.Args)+3)
+	for k, v := range suite.Args {
+		args[k] = v
+	}
+	args["script"] = suite.Script
+	args["hotReload"] = false
+	args["poolMaxSize"] = int64(1)
+	ctx := newScriptTestContext(suite.Globals, suite.stubUuids())
+	defer ctx.store.Close()
+
+	var run func(tc ScriptTestCase, deliverer gecko.OutputDeliverer) (map[string]interface{}, error)
+	var lifeCycle gecko.LifeCycle
+	switch suite.Type {
+	case ScriptTestDriver:
+		driver := NewScriptDriver()
+		driver.OnInit(args, ctx)
+		lifeCycle = driver
+		run = func(tc ScriptTestCase, deliverer gecko.OutputDeliverer) (map[string]interface{}, error) {
+			out, err := driver.Drive(tc.attributes(), tc.Topic, tc.Uuid, newTestInbound(tc.Inbound), deliverer, ctx)
+			if nil != err || nil == out {
+				return nil, err
+			}
+			return packetToMap(out), nil
+		}
+	case ScriptTestTrigger:
+		trigger := NewScriptTrigger()
+		trigger.OnInit(args, ctx)
+		lifeCycle = trigger
+		run = func(tc ScriptTestCase, deliverer gecko.OutputDeliverer) (map[string]interface{}, error) {
+			return nil, trigger.Touch(tc.attributes(), tc.Topic, tc.Uuid, newTestInbound(tc.Inbound), deliverer, ctx)
+		}
+	case ScriptTestOutput:
+		output := NewScriptOutput()
+		output.OnInit(args, ctx)
+		lifeCycle = output
+		run = func(tc ScriptTestCase, _ gecko.OutputDeliverer) (map[string]interface{}, error) {
+			frame, err := output.Process(gecko.FramePacket(value.Of(tc.Inbound[FramesKey]).String()), ctx)
+			if nil != err {
+				return nil, err
+			}
+			return map[string]interface{}{FramesKey: string(frame)}, nil
+		}
+	default:
+		return nil, errors.Errorf("不支持的脚本类型: %s", suite.Type)
+	}
+	if err := startScriptComponent(lifeCycle, ctx); nil != err {
+		return nil, err
+	}
+	defer lifeCycle.OnStop(ctx)
+
+	results := make([]ScriptTestResult, 0, len(suite.Cases))
+	for _, tc := range suite.Cases {
+		results = append(results, runScriptTestCase(tc, run))
+	}
+	return results, nil
+}
+
+// 全部用例stubs的目标UUID，按字母排序
+func (suite *ScriptTestSuite) stubUuids() []string {
+	seen := make(map[string]bool)
+	uuids := make([]string, 0)
+	for _, tc := range suite.Cases {
+		for uuid := range tc.Stubs {
+			if !seen[uuid] {
+				seen[uuid] = true
+				uuids = append(uuids, uuid)
+			}
+		}
+	}
+	sort.Strings(uuids)
+	return uuids
+}
+
+// 启动组件；脚本加载失败时组件会panic，转换为错误返回
+func startScriptComponent(lifeCycle gecko.LifeCycle, ctx gecko.Context) (err error) {
+	defer func() {
+		if r := recover(); nil != r {
+			err = errors.Errorf("加载脚本失败: %v", r)
+		}
+	}()
+	lifeCycle.OnStart(ctx)
+	return nil
+}
+
+func runScriptTestCase(tc ScriptTestCase,
+	run func(tc ScriptTestCase, deliverer gecko.OutputDeliverer) (map[string]interface{}, error)) ScriptTestResult {
+	result := ScriptTestResult{Name: tc.Name}
+	fail := func(format string, args ...interface{}) {
+		result.Failures = append(result.Failures, fmt.Sprintf(format, args...))
+	}
+	delivered := make([]string, 0)
+	deliverer := gecko.OutputDeliverer(func(uuid string, msg *gecko.MessagePacket) (*gecko.MessagePacket, error) {
+		delivered = append(delivered, uuid)
+		stub, ok := tc.Stubs[uuid]
+		if !ok {
+			return nil, errors.New("no stub for target uuid: " + uuid)
+		}
+		if "" != stub.Error {
+			return nil, errors.New(stub.Error)
+		}
+		return gecko.NewMessagePacketFields(normalizeValue(stub.Response).(map[string]interface{})), nil
+	})
+	actual, err := run(tc, deliverer)
+	switch {
+	case nil != err && "" == tc.Expect.Error:
+		fail("unexpected error: %s", err)
+	case nil == err && "" != tc.Expect.Error:
+		fail("expected error containing %q, got nil", tc.Expect.Error)
+	case nil != err && !strings.Contains(err.Error(), tc.Expect.Error):
+		fail("expected error containing %q, got: %s", tc.Expect.Error, err)
+	}
+	keys := make([]string, 0, len(tc.Expect.Result))
+	for k := range tc.Expect.Result {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if v, ok := actual[k]; !ok {
+			fail("result.%s: missing, expected %v", k, tc.Expect.Result[k])
+		} else if !matchExpected(tc.Expect.Result[k], v) {
+			fail("result.%s: expected %v, got %v", k, tc.Expect.Result[k], v)
+		}
+	}
+	if nil != tc.Expect.Delivered && !reflect.DeepEqual(tc.Expect.Delivered, delivered) {
+		fail("delivered: expected %v, got %v", tc.Expect.Delivered, delivered)
+	}
+	return result
+}
+
+// 比较期望值与实际值：Map只比较期望值中存在的字段；数值按float64比较
+func matchExpected(expected, actual interface{}) bool {
+	switch e := expected.(type) {
+	case map[string]interface{}:
+		a, ok := actual.(map[string]interface{})
+		if !ok {
+			return false
+		}
+		for k, v := range e {
+			if !matchExpected(v, a[k]) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		a, ok := actual.([]interface{})
+		if !ok || len(a) != len(e) {
+			return false
+		}
+		for i := range e {
+			if !matchExpected(e[i], a[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	if ef, ok := numberOf(expected); ok {
+		af, ok := numberOf(actual)
+		return ok && ef == af
+	}
+	return reflect.DeepEqual(expected, actual)
+}
+
+func numberOf(val interface{}) (float64, bool) {
+	rv := reflect.ValueOf(val)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(rv.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return rv.Float(), true
+	default:
+		return 0, false
+	}
+}
+
+func newTestInbound(inbound map[string]interface{}) *gecko.MessagePacket {
+	fields := make(map[string]interface{}, len(inbound))
+	var frames []byte
+	for k, v := range inbound {
+		if FramesKey == k {
+			frames = []byte(value.Of(v).String())
+		} else {
+			fields[k] = v
+		}
+	}
+	return gecko.NewMessagePacketWith(fields, frames)
+}
+
+func packetToMap(msg *gecko.MessagePacket) map[string]interface{} {
+	out := msg.GetFields()
+	if frames := msg.GetFrames(); len(frames) > 0 {
+		out[FramesKey] = string(frames)
+	}
+	return out
+}
+
+////
+
+// 测试脚本中不可用的功能
+var errNotAvailableInTest = errors.New("not available in test-script")
+
+// 脚本测试使用的Context，提供脚本可以访问的函数。
+// 嵌入的 gecko.Context 为nil，只用于满足接口的内部函数；全部公开函数均由scriptTestContext实现。
+type scriptTestContext struct {
+	gecko.Context
+	globals map[string]interface{}
+	store   *gecko.MemoryStateStore
+	scoped  map[interface{}]interface{}
+	outputs []string
+}
+
+func newScriptTestContext(globals map[string]interface{}, outputs []string) *scriptTestContext {
+	return &scriptTestContext{
+		globals: globals,
+		store:   gecko.NewMemoryStateStore(),
+		scoped:  make(map[interface{}]interface{}),
+		outputs: outputs,
+	}
+}
+
+// 返回由stubs的UUID创建的Output设备列表
+func (c *scriptTestContext) GetOutputDevices() *list.List {
+	out := list.New()
+	for _, uuid := range c.outputs {
+		out.PushBack(&scriptTestOutput{AbcOutputDevice: gecko.NewAbcOutputDevice(), uuid: uuid})
+	}
+	return out
+}
+
+// 测试脚本中没有其它组件，返回空列表
+func (c *scriptTestContext) GetInputDevices() *list.List         { return list.New() }
+func (c *scriptTestContext) GetInterceptors() *list.List         { return list.New() }
+func (c *scriptTestContext) GetOutboundInterceptors() *list.List { return list.New() }
+func (c *scriptTestContext) GetDrivers() *list.List              { return list.New() }
+func (c *scriptTestContext) GetTriggers() *list.List             { return list.New() }
+func (c *scriptTestContext) GetPlugins() *list.List              { return list.New() }
+
+func (c *scriptTestContext) CheckTimeout(msg string, timeout time.Duration, action func()) {
+	action()
+}
+
+func (c *scriptTestContext) Publisher() gecko.Publisher {
+	return scriptTestPublisher{}
+}
+
+func (c *scriptTestContext) Version() string                      { return gecko.Version }
+func (c *scriptTestContext) Domain() string                       { return "test" }
+func (c *scriptTestContext) NodeId() string                       { return "test" }
+func (c *scriptTestContext) GlobalConfig() map[string]interface{} { return c.globals }
+func (c *scriptTestContext) StateStore() gecko.StateStore         { return c.store }
+func (c *scriptTestContext) IsVerboseEnabled() bool               { return false }
+func (c *scriptTestContext) IsFailFastEnabled() bool              { return false }
+func (c *scriptTestContext) OnIfLogV(fun func())                  {}
+func (c *scriptTestContext) OnIfFailFast(fun func())              {}
+
+func (c *scriptTestContext) GetScoped(key interface{}) interface{} {
+	return c.scoped[key]
+}
+
+func (c *scriptTestContext) PutScoped(key interface{}, value interface{}) {
+	c.scoped[key] = value
+}
+
+// 测试脚本中的Output设备，只提供UUID；不能处理数据
+type scriptTestOutput struct {
+	*gecko.AbcOutputDevice
+	uuid string
+}
+
+func (o *scriptTestOutput) GetUuid() string {
+	return o.uuid
+}
+
+func (o *scriptTestOutput) Process(frame gecko.FramePacket, ctx gecko.Context) (gecko.FramePacket, error) {
+	return nil, errors.Wrap(errNotAvailableInTest, "OutputDevice.Process")
+}
+
+// 测试脚本中的事件发布接口，总是返回错误
+type scriptTestPublisher struct{}
+
+func (scriptTestPublisher) Publish(attrs gecko.Attributes, topic string, uuid string, msg *gecko.MessagePacket) error {
+	return errors.Wrap(errNotAvailableInTest, "Publisher.Publish")
+}
+
+func (scriptTestPublisher) Request(attrs gecko.Attributes, topic string, uuid string, msg *gecko.MessagePacket, timeout time.Duration) (*gecko.MessagePacket, error) {
+	return nil, errors.Wrap(errNotAvailableInTest, "Publisher.Request")
+}
@@ -0,0 +1,142 @@
+package lua
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const testCaseDriverScript = `
+local gecko = require("gecko")
+function driverMain(args, request, deliverFn)
+    if request.inbound.card == nil then
+        return nil, "card is required"
+    end
+    local ret, err = deliverFn(args.targetUuid, {card = request.inbound.card})
+    if err ~= nil then
+        return nil, err
+    end
+    return {
+        state = ret.state, user = request.attrs.user, door = request.vars.door,
+        region = gecko.globalConfig().region, outputs = table.concat(gecko.outputs(), ","),
+    }, nil
+end
+`
+
+const testCaseYaml = `
+script: driver.lua
+type: driver
+args:
+  targetUuid: OUTPUT-1
+globals:
+  region: cn
+cases:
+  - name: open door
+    topic: /door/1
+    uuid: INPUT-1
+    attrs: {user: admin}
+    vars: {door: "1"}
+    inbound: {card: "123"}
+    stubs:
+      OUTPUT-1: {response: {state: ok}}
+    expect:
+      result: {state: ok, user: admin, door: "1", region: cn, outputs: OUTPUT-1}
+      delivered: [OUTPUT-1]
+  - name: missing card
+    inbound: {}
+    expect:
+      error: card is required
+      delivered: []
+  - name: output failed
+    inbound: {card: "123"}
+    stubs:
+      OUTPUT-1: {error: offline}
+    expect:
+      error: offline
+  - name: wrong expectation
+    inbound: {card: "123"}
+    stubs:
+      OUTPUT-1: {response: {state: denied}}
+    expect:
+      result: {state: ok}
+`
+
+const testCaseToml = `
+script = "driver.lua"
+type = "driver"
+[args]
+  targetUuid = "OUTPUT-1"
+[[cases]]
+  name = "open door"
+  [cases.inbound]
+    card = "123"
+  [cases.stubs.OUTPUT-1.response]
+    state = "ok"
+  [cases.expect.result]
+    state = "ok"
+`
+
+const testCaseJson = `{
+  "script": "output.lua",
+  "type": "output",
+  "cases": [
+    {"name": "echo", "inbound": {"frames": "ping"}, "expect": {"result": {"frames": "PING"}}}
+  ]
+}`
+
+func writeTestCaseFiles(t *testing.T, files map[string]string) string {
+	dir, err := ioutil.TempDir("", "gecko-testcase")
+	assert.NoError(t, err)
+	for name, content := range files {
+		assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644))
+	}
+	return dir
+}
+
+func TestRunScriptTestFile(t *testing.T) {
+	dir := writeTestCaseFiles(t, map[string]string{
+		"driver.lua":     testCaseDriverScript,
+		"output.lua":     `function outputMain(args, frame) return string.upper(frame), nil end`,
+		"cases.yaml":     testCaseYaml,
+		"cases.toml":     testCaseToml,
+		"cases.json":     testCaseJson,
+		"cases.txt":      "",
+		"bad-script.yml": "script: missing.lua\ntype: driver\n",
+	})
+	defer os.RemoveAll(dir)
+
+	results, err := RunScriptTestFile(filepath.Join(dir, "cases.yaml"))
+	assert.NoError(t, err)
+	assert.Equal(t, 4, len(results))
+	for _, r := range results[:3] {
+		assert.True(t, r.Passed(), "%s: %v", r.Name, r.Failures)
+	}
+	assert.False(t, results[3].Passed())
+	assert.Contains(t, results[3].Failures[0], "result.state")
+
+	results, err = RunScriptTestFile(filepath.Join(dir, "cases.toml"))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(results))
+	assert.True(t, results[0].Passed(), "%v", results[0].Failures)
+
+	results, err = RunScriptTestFile(filepath.Join(dir, "cases.json"))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(results))
+	assert.True(t, results[0].Passed(), "%v", results[0].Failures)
+
+	_, err = RunScriptTestFile(filepath.Join(dir, "cases.txt"))
+	assert.Error(t, err)
+	_, err = RunScriptTestFile(filepath.Join(dir, "bad-script.yml"))
+	assert.Error(t, err)
+}
+
+func TestMatchExpected(t *testing.T) {
+	assert.True(t, matchExpected(1, float64(1)))
+	assert.False(t, matchExpected(1, "1"))
+	assert.True(t, matchExpected(map[string]interface{}{"a": 1}, map[string]interface{}{"a": float64(1), "b": 2}))
+	assert.False(t, matchExpected(map[string]interface{}{"a": 1}, map[string]interface{}{"b": 2}))
+	assert.True(t, matchExpected([]interface{}{"x", 2}, []interface{}{"x", float64(2)}))
+	assert.False(t, matchExpected([]interface{}{"x"}, []interface{}{"x", "y"}))
+}
@@ -0,0 +1,35 @@
+package nop
+
+import (
+	"github.com/yoojia/go-gecko/v2"
+)
+
+//
+// Author: 陈哈哈 chenyongjia@parkingwang.com, yoojiachen@gmail.com
+//
+
+type NopOutboundInterceptor struct {
+	*gecko.AbcOutboundInterceptor
+	gecko.Initial
+}
+
+func (no *NopOutboundInterceptor) OnInit(config map[string]interface{}, ctx gecko.Context) {
+
+}
+
+func (no *NopOutboundInterceptor) HandleOutbound(attrs gecko.Attributes, topic string, uuid string, in *gecko.MessagePacket, out *gecko.MessagePacket, ctx gecko.Context) (*gecko.MessagePacket, error) {
+	//out.AddField("timestamp", time.Now().Unix())
+	return out, nil
+}
+
+func NewNopOutboundInterceptor() gecko.OutboundInterceptor {
+	return &NopOutboundInterceptor{
+		AbcOutboundInterceptor: gecko.NewAbcOutboundInterceptor(),
+	}
+}
+
+func NopOutboundInterceptorFactory() (string, gecko.Factory) {
+	return "NopOutboundInterceptor", func() interface{} {
+		return NewNopOutboundInterceptor()
+	}
+}
@@ -0,0 +1,71 @@
+package gecko
+
+//
+// Author: 陈哈哈 chenyongjia@parkingwang.com, yoojiachen@gmail.com
+//
+
+// OutboundInterceptor 响应拦截器
+// 在Driver返回响应数据之后、InputDevice的Encoder编码之前执行，可以对响应数据进行审计、脱敏、补充或者改写，
+// 例如添加门禁控制器要求的签名和时间戳。与Interceptor一样，按Topic过滤，按优先级从高到低依次执行。
+type OutboundInterceptor interface {
+	NeedTopicFilter
+	NeedName
+	// OutboundInterceptor可设置优先级
+	GetPriority() int
+	setPriority(p int)
+	// 处理Driver的响应数据。in 为请求消息，out 为当前的响应消息。
+	// 返回新的响应消息以替换 out；返回nil时使用 out（可直接修改 out 的字段）。
+	// 返回错误时记录错误，保持当前响应消息并继续执行后续拦截器。
+	HandleOutbound(attrs Attributes, topic string, uuid string, in *MessagePacket, out *MessagePacket, ctx Context) (*MessagePacket, error)
+}
+
+// OutboundInterceptor抽象实现
+type AbcOutboundInterceptor struct {
+	OutboundInterceptor
+	name     string
+	priority int
+	topics   []*TopicExpr
+	where    *WhereExpr
+}
+
+func (ai *AbcOutboundInterceptor) setName(name string) {
+	ai.name = name
+}
+
+func (ai *AbcOutboundInterceptor) GetName() string {
+	return ai.name
+}
+
+func (ai *AbcOutboundInterceptor) GetPriority() int {
+	return ai.priority
+}
+
+func (ai *AbcOutboundInterceptor) setPriority(priority int) {
+	ai.priority = priority
+}
+
+func (ai *AbcOutboundInterceptor) setTopics(topics []string) {
+	for _, t := range topics {
+		ai.topics = append(ai.topics, newTopicExpr(t))
+	}
+}
+
+func (ai *AbcOutboundInterceptor) GetTopicExpr() []*TopicExpr {
+	return ai.topics
+}
+
+// 设置消息内容过滤表达式。OutboundInterceptor的过滤表达式作用于响应消息。
+func (ai *AbcOutboundInterceptor) setWhere(where *WhereExpr) {
+	ai.where = where
+}
+
+// 获取消息内容过滤表达式
+func (ai *AbcOutboundInterceptor) GetWhereExpr() *WhereExpr {
+	return ai.where
+}
+
+func NewAbcOutboundInterceptor() *AbcOutboundInterceptor {
+	return &AbcOutboundInterceptor{
+		topics: make([]*TopicExpr, 0),
+	}
+}
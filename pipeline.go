@@ -9,6 +9,7 @@ import (
 	"os"
 	"os/signal"
 	"sort"
+	"sync"
 	"syscall"
 	"time"
 )
@@ -26,6 +27,12 @@ type Pipeline struct {
 	interceptorChan chan *session
 	driverChan      chan *session
 	triggerChan     chan *session
+	// Driver调度策略和聚合模式的合并函数
+	driverStrategy string
+	driverMerger   DriverMergeFunc
+	// 按Topic查找组件的路由表
+	routerOnce sync.Once
+	router     *topicRouter
 	// 服务终止信号
 	termCtx    context.Context
 	termCancel context.CancelFunc
@@ -37,15 +44,20 @@ func (p *Pipeline) Init(config map[string]interface{}) {
 		cfgGeckos:       utils.ToMap(config["GECKO"]),
 		cfgGlobals:      utils.ToMap(config["GLOBALS"]),
 		cfgInterceptors: utils.ToMap(config["INTERCEPTORS"]),
+		cfgOutbounds:    utils.ToMap(config["OUTBOUNDS"]),
 		cfgDrivers:      utils.ToMap(config["DRIVERS"]),
 		cfgTriggers:     utils.ToMap(config["TRIGGERS"]),
 		cfgOutputs:      utils.ToMap(config["OUTPUTS"]),
 		cfgInputs:       utils.ToMap(config["INPUTS"]),
 		cfgPlugins:      utils.ToMap(config["PLUGINS"]),
 		cfgLogics:       utils.ToMap(config["LOGICS"]),
+		cfgSchemas:      utils.ToMap(config["SCHEMAS"]),
+		cfgRoutes:       utils.ToMap(config["ROUTES"]),
+		cfgCodecs:       utils.ToMap(config["CODECS"]),
 		scopedKV:        make(map[interface{}]interface{}),
 		plugins:         p.plugins,
 		interceptors:    p.interceptors,
+		outbounds:       p.outbounds,
 		drivers:         p.drivers,
 		triggers:        p.triggers,
 		outputs:         p.outputs,
@@ -54,6 +66,14 @@ func (p *Pipeline) Init(config map[string]interface{}) {
 
 	p.context.prepare()
 
+	ctx := p.context.(*_GeckoContext)
+	store, err := newStateStore(ctx.cfgGeckos)
+	if nil != err {
+		log.Panicw("创建状态存储出错", "error", err)
+	}
+	ctx.stateStore = store
+	ctx.publisher = newPipelinePublisher(p, ctx.cfgGeckos)
+
 	capacity := value.Of(p.context.gecko()["eventsCapacity"]).Int64OrDefault(64)
 	if capacity <= 0 {
 		capacity = 1
@@ -83,7 +103,10 @@ func (p *Pipeline) Init(config map[string]interface{}) {
 		it.Init(structConfig, p.context)
 	}
 
-	ctx := p.context.(*_GeckoContext)
+	// 编码解码组件必须在设备组件之前注册
+	if 0 != len(ctx.cfgCodecs) {
+		p.register(ctx.cfgCodecs, mappedInitFn, structInitFn)
+	}
 	if 0 == len(ctx.cfgPlugins) {
 		log.Warn("警告：未配置任何[Plugin]组件")
 	} else {
@@ -99,6 +122,10 @@ func (p *Pipeline) Init(config map[string]interface{}) {
 	} else {
 		p.register(ctx.cfgInterceptors, mappedInitFn, structInitFn)
 	}
+	// [OUTBOUNDS]响应拦截器是可选的
+	if 0 != len(ctx.cfgOutbounds) {
+		p.register(ctx.cfgOutbounds, mappedInitFn, structInitFn)
+	}
 	if 0 == len(ctx.cfgDrivers) {
 		log.Warn("警告：未配置任何[Driver]组件")
 	} else {
@@ -119,6 +146,13 @@ func (p *Pipeline) Init(config map[string]interface{}) {
 	} else {
 		p.register(ctx.cfgLogics, mappedInitFn, structInitFn)
 	}
+	if 0 != len(ctx.cfgSchemas) {
+		p.registerSchemas(ctx.cfgSchemas)
+	}
+	if 0 != len(ctx.cfgRoutes) {
+		p.registerRoutes(ctx.cfgRoutes)
+	}
+	p.prepareDriverStrategy(ctx.cfgGeckos)
 	// show
 	p.showComponents()
 }
@@ -129,20 +163,24 @@ func (p *Pipeline) Start() {
 	// 检查运行时依赖关系:
 	// 注意：
 	// Driver是直接接收Input，并驱动Output获取响应的重要节点。
-	// 每个Input产生的Topic,只允许单独一个driver处理, 不允许多个Driver处理同一个Topic。
+	// exclusive策略下，每个Input产生的Topic,只允许单独一个driver处理, 不允许多个Driver处理同一个Topic。
 	// Trigger组件负责处理相同Topic的联动逻辑。
 	utils.ForEach(p.inputs, func(it interface{}) {
-		topic := it.(InputDevice).GetTopic()
-		hits := make([]Driver, 0)
-		utils.ForEach(p.drivers, func(dr interface{}) {
-			driver := dr.(Driver)
-			if anyTopicMatches(driver.GetTopicExpr(), topic) {
-				hits = append(hits, driver)
+		if DriverStrategyExclusive != p.driverStrategy || InputModeOneway == it.(InputDevice).GetMode() {
+			return
+		}
+		// 无条件的Topic改写规则在启动时即可确定目标Topic
+		topic, _ := p.topicRoutes.route(it.(InputDevice).GetTopic(), nil)
+		// 设置了[where]过滤的Driver按消息内容处理同一Topic的不同子集，不参与检查
+		hits := make([]interface{}, 0)
+		for _, hit := range p.routes().drivers.match(tokenizeTopic(topic)) {
+			if nil == whereOf(hit.value) {
+				hits = append(hits, hit.value)
 			}
-		})
+		}
 		if len(hits) > 1 {
 			for _, dr := range hits {
-				log.Errorf("Topic被多个Driver处理, Driver: %s, Topic: %s", dr.GetName(), topic)
+				log.Errorf("Topic被多个Driver处理, Driver: %s, Topic: %s", dr.(Driver).GetName(), topic)
 			}
 			log.Panicf("禁止多个Driver处理相同的Topic")
 		}
@@ -170,14 +208,22 @@ func (p *Pipeline) Start() {
 
 	// Hook first
 	utils.ForEach(p.startBeforeHooks, func(it interface{}) { it.(HookFunc)(p) })
+	// Codecs
+	utils.ForEach(p.codecs, p.callStartFunc)
 	// Plugins
 	utils.ForEach(p.plugins, p.callStartFunc)
 	// Outputs
 	utils.ForEach(p.outputs, p.callStartFunc)
+	// Interceptors
+	utils.ForEach(p.interceptors, p.callStartFunc)
+	// OutboundInterceptors
+	utils.ForEach(p.outbounds, p.callStartFunc)
 	// Drivers
 	utils.ForEach(p.drivers, p.callStartFunc)
 	// Triggers
 	utils.ForEach(p.triggers, p.callStartFunc)
+	// Logics
+	utils.ForEach(p.logics, p.callStartFunc)
 	// Inputs
 	utils.ForEach(p.inputs, p.callStartFunc)
 	// Then, Serve inputs
@@ -207,6 +253,12 @@ func (p *Pipeline) Stop() {
 	utils.ForEach(p.stopBeforeHooks, func(it interface{}) { it.(HookFunc)(p) })
 	// Inputs
 	utils.ForEach(p.inputs, p.callStopFunc)
+	// Logics
+	utils.ForEach(p.logics, p.callStopFunc)
+	// Interceptors
+	utils.ForEach(p.interceptors, p.callStopFunc)
+	// OutboundInterceptors
+	utils.ForEach(p.outbounds, p.callStopFunc)
 	// Drivers
 	utils.ForEach(p.drivers, p.callStopFunc)
 	// Triggers
@@ -215,8 +267,14 @@ func (p *Pipeline) Stop() {
 	utils.ForEach(p.outputs, p.callStopFunc)
 	// Plugins
 	utils.ForEach(p.plugins, p.callStopFunc)
+	// Codecs
+	utils.ForEach(p.codecs, p.callStopFunc)
 	// Hook After
 	utils.ForEach(p.stopAfterHooks, func(it interface{}) { it.(HookFunc)(p) })
+	// 组件全部停止后，关闭状态存储
+	if err := p.context.StateStore().Close(); nil != err {
+		log.Errorw("关闭状态存储出错", "error", err)
+	}
 
 	log.Info("Pipeline停止...OK")
 	// 最终发起Dispatch停止信号
@@ -274,19 +332,46 @@ func (p *Pipeline) newInputDeliverer(master InputDevice) InputDeliverer {
 			inputTopic = logic.GetTopic()
 			input = logic.Transform(input)
 		}
+		// 按[ROUTES]规则改写Topic
+		if target, route := p.topicRoutes.route(inputTopic, input); nil != route {
+			attributes[TopicOriginAttrKey] = inputTopic
+			attributes[TopicRouteAttrKey] = route.Name
+			inputTopic = target
+		}
+		// 校验消息数据，不符合Schema的消息直接返回错误响应，不进入Interceptor处理
+		tokens := tokenizeTopic(inputTopic)
+		oneway := InputModeOneway == master.GetMode()
+		if violations := p.validateSchema(masterUuid, tokens, input); len(violations) > 0 {
+			log.Debugw("消息数据校验失败", "uuid", inputUuid, "topic", inputTopic, "violations", violations)
+			// 单向模式不返回响应数据，直接丢弃
+			if oneway {
+				return nil, nil
+			}
+			if encodedFrame, err := master.GetEncoder()(newSchemaInvalidPacket(violations)); nil != err {
+				return nil, errors.WithMessage(err, "Input设备Encode数据出错: "+masterUuid)
+			} else {
+				return FramePacket(encodedFrame), nil
+			}
+		}
 		// 发送到Dispatcher调度处理
 		session := &session{
 			attrs:     newMapAttributesWith(attributes),
 			timestamp: time.Now(),
 			topic:     inputTopic,
+			tokens:    tokens,
 			uuid:      inputUuid,
 			inbound:   input,
 			outbound:  make(chan *MessagePacket, 1),
+			oneway:    oneway,
 		}
 
 		// 传递给interceptor通道来处理
 		start := time.Now()
 		p.interceptorChan <- session
+		// 单向模式：进入处理队列后立即返回，不等待处理结果，不调用Encoder
+		if oneway {
+			return nil, nil
+		}
 		// 等待Session处理完成
 		output := <-session.outbound
 		du := time.Since(start)
@@ -311,6 +396,20 @@ func (p *Pipeline) newInputDeliverer(master InputDevice) InputDeliverer {
 	})
 }
 
+// 使用InputDevice和Topic匹配的Schema校验消息数据
+func (p *Pipeline) validateSchema(masterUuid string, topic topicTokens, msg *MessagePacket) []SchemaViolation {
+	violations := make([]SchemaViolation, 0)
+	if schema, ok := p.inputSchemas[masterUuid]; ok {
+		violations = append(violations, schema.Validate(msg.GetFields())...)
+	}
+	for _, ts := range p.topicSchemas {
+		if anyTopicMatches(ts.topics, topic) {
+			violations = append(violations, ts.schema.Validate(msg.GetFields())...)
+		}
+	}
+	return violations
+}
+
 // 输出派发函数
 // 根据Driver指定的目标输出设备地址，查找并处理数据包
 func (p *Pipeline) deliverToOutput(uuid string, rawJSON *MessagePacket) (*MessagePacket, error) {
@@ -336,6 +435,14 @@ func (p *Pipeline) deliverToOutput(uuid string, rawJSON *MessagePacket) (*Messag
 	}
 }
 
+// 返回按Topic查找组件的路由表。路由表在首次使用时根据已注册组件创建。
+func (p *Pipeline) routes() *topicRouter {
+	p.routerOnce.Do(func() {
+		p.router = newTopicRouter(p.Register)
+	})
+	return p.router
+}
+
 // 处理拦截器过程
 func (p *Pipeline) doInterceptor(session *session) {
 	topic := session.Topic()
@@ -343,50 +450,139 @@ func (p *Pipeline) doInterceptor(session *session) {
 		log.Debugf("正在Interceptor调度过程，Topic: %s", topic)
 	})
 	// 查找匹配的拦截器，按优先级排序并处理
-	matches := make(InterceptorSlice, 0)
-	for el := p.interceptors.Front(); el != nil; el = el.Next() {
-		interceptor := el.Value.(Interceptor)
-		name := interceptor.GetName()
-		if anyTopicMatches(interceptor.GetTopicExpr(), topic) {
-			matches = append(matches, interceptor)
-		} else {
-			p.context.OnIfLogV(func() {
-				log.Debugf("拦截器[未匹配], Name: %s, topic: %s", name, topic)
-			})
-		}
-	}
-	sort.Sort(matches)
+	hits := p.routes().interceptors.match(session.tokens)
+	p.context.OnIfLogV(func() {
+		log.Debugf("Topic匹配拦截器数量: %d, topic: %s", len(hits), topic)
+	})
+	sort.SliceStable(hits, func(i, j int) bool {
+		return hits[i].value.(Interceptor).GetPriority() > hits[j].value.(Interceptor).GetPriority()
+	})
 	// 按排序结果顺序执行
 	defer func() {
 		p.checkRecover(recover(), "Interceptor-Goroutine内部错误")
 	}()
 
-	for _, it := range matches {
+	for _, hit := range hits {
+		it := hit.value.(Interceptor)
+		attrs := hit.attrs(session)
+		// 过滤表达式作用于前序拦截器替换后的Inbound消息
+		if !whereOf(it).Match(attrs, session.GetInbound()) {
+			continue
+		}
 		itName := it.GetName()
 		start := time.Now()
-		err := it.Handle(session.Attrs(), session.Topic(), session.Uuid(), session.GetInbound(), p.context)
+		err := it.Handle(attrs, session.Topic(), session.Uuid(), session.GetInbound(), p.context)
 		session.Attrs().Add("@Interceptor.Cost."+itName, time.Since(start))
 		if err == nil {
 			continue
 		}
-		if err == ErrInterceptorDropped {
-			log.Debugf("拦截器[%s]中断事件: %s", itName, err.Error())
-			session.WriteOutbound(NewMessagePacketFields(map[string]interface{}{
-				"error": "INTERCEPTOR_DROPPED",
-			}))
+		if !p.interceptorResult(session, it, err) {
 			return // 直接Return, 终止后续处理过程
-		} else {
-			p.failFastLogger("拦截器发生错误("+itName+"): ", err)
 		}
 	}
 	// 后续处理
 	session.Attrs().Add("@Interceptor.SINCE", session.Since())
-	// 1. Driver驱动处理
+	// 1. Driver驱动处理；单向事件不执行Driver
 	// 2. Trigger触发处理
-	p.driverChan <- session
+	if !session.oneway {
+		p.driverChan <- session
+	}
 	p.triggerChan <- session
 }
 
+// 处理拦截器返回的结果，返回是否继续后续处理过程
+func (p *Pipeline) interceptorResult(session *session, it Interceptor, err error) bool {
+	itName := it.GetName()
+	if err == ErrInterceptorDropped {
+		err = &InterceptedResult{action: interceptActionDrop}
+	}
+	if ret, ok := err.(*InterceptedResult); ok {
+		switch ret.action {
+		case interceptActionReplace:
+			replaced, _ := session.Attrs().GetOrNil(InterceptorReplacedAttrKey).([]string)
+			session.Attrs().Add(InterceptorReplacedAttrKey, append(replaced, itName))
+			session.inbound = ret.packet
+			return true
+
+		case interceptActionReply:
+			log.Debugf("拦截器[%s]响应事件", itName)
+			session.Attrs().Add(InterceptorRepliedAttrKey, itName)
+			session.WriteOutbound(ret.packet)
+
+		default:
+			log.Debugf("拦截器[%s]中断事件: %s", itName, ret.Error())
+			session.Attrs().Add(InterceptorDroppedAttrKey, itName)
+			fields := map[string]interface{}{
+				"error": "INTERCEPTOR_DROPPED",
+			}
+			if "" != ret.reason {
+				session.Attrs().Add(InterceptorReasonAttrKey, ret.reason)
+				fields["reason"] = ret.reason
+			}
+			session.WriteOutbound(NewMessagePacketFields(fields))
+		}
+		return false
+	}
+	errs, _ := session.Attrs().GetOrNil(InterceptorErrorsAttrKey).(map[string]string)
+	if nil == errs {
+		errs = make(map[string]string)
+		session.Attrs().Add(InterceptorErrorsAttrKey, errs)
+	}
+	errs[itName] = err.Error()
+	p.failFastLogger("拦截器发生错误("+itName+"): ", err)
+	if InterceptorOnErrorAbort != it.GetErrorPolicy() {
+		return true
+	}
+	session.Attrs().Add(InterceptorAbortedAttrKey, itName)
+	session.WriteOutbound(NewMessagePacketFields(map[string]interface{}{
+		"error":  "INTERCEPTOR_ERROR",
+		"reason": err.Error(),
+	}))
+	return false
+}
+
+// 读取[GECKO]配置项中的Driver调度策略和合并函数
+func (p *Pipeline) prepareDriverStrategy(geckos map[string]interface{}) {
+	p.driverStrategy = value.Of(geckos["driverStrategy"]).String()
+	if "" == p.driverStrategy {
+		p.driverStrategy = DriverStrategyExclusive
+	}
+	switch p.driverStrategy {
+	case DriverStrategyExclusive, DriverStrategyPriority, DriverStrategyAggregate:
+	default:
+		log.Panicw("配置项[driverStrategy]错误", "driverStrategy", p.driverStrategy)
+	}
+	merge := value.Of(geckos["driverMerge"]).String()
+	if "" == merge {
+		merge = DriverMergeFields
+	}
+	if merger, ok := p.driverMergers[merge]; ok {
+		p.driverMerger = merger
+	} else {
+		log.Panicw("配置项[driverMerge]指定的合并函数未注册", "driverMerge", merge)
+	}
+	log.Infof("Driver调度策略: %s, 合并函数: %s", p.driverStrategy, merge)
+}
+
+// 查找满足Topic和[where]过滤条件的Driver，按优先级排序。
+// 非聚合模式下只返回第一个Driver；没有Driver匹配时返回满足[where]过滤条件的Fallback Driver。
+func (p *Pipeline) matchDrivers(session *session) []topicMatch {
+	drivers := make([]topicMatch, 0)
+	for _, hit := range p.routes().drivers.match(session.tokens) {
+		if whereOf(hit.value).Match(hit.attrs(session), session.GetInbound()) {
+			drivers = append(drivers, hit)
+			if DriverStrategyAggregate != p.driverStrategy {
+				break
+			}
+		}
+	}
+	if 0 == len(drivers) && nil != p.fallbackDriver &&
+		whereOf(p.fallbackDriver).Match(session.Attrs(), session.GetInbound()) {
+		drivers = append(drivers, topicMatch{value: p.fallbackDriver})
+	}
+	return drivers
+}
+
 // 处理驱动执行过程
 func (p *Pipeline) doDriver(session *session) {
 	topic := session.Topic()
@@ -394,22 +590,13 @@ func (p *Pipeline) doDriver(session *session) {
 		log.Debugf("Driver调度，Topic: %s", topic)
 	})
 	// 查找匹配的用户驱动
-	var driver Driver
-	for el := p.drivers.Front(); el != nil; el = el.Next() {
-		d := el.Value.(Driver)
-		if anyTopicMatches(d.GetTopicExpr(), topic) {
-			driver = d
-			// 只匹配一个Driver
-			break
-		} else {
-			p.context.OnIfLogV(func() {
-				log.Debugf("用户驱动[未匹配], Driver: %s, topic: %s", d.GetName(), topic)
-			})
-		}
-	}
+	drivers := p.matchDrivers(session)
 
 	var outbound *MessagePacket
-	if nil != driver {
+	if len(drivers) > 1 {
+		outbound = p.aggregateDrivers(session, drivers)
+	} else if 1 == len(drivers) {
+		driver := drivers[0].value.(Driver)
 		driName := driver.GetName()
 		// Driver 处理
 		log.Debugf("用户驱动正在处理, Driver: %s, topic: %s", driName, topic)
@@ -418,7 +605,7 @@ func (p *Pipeline) doDriver(session *session) {
 		}()
 		start := time.Now()
 		ret, err := driver.Drive(
-			session.Attrs(), session.Topic(), session.Uuid(), session.GetInbound(),
+			drivers[0].attrs(session), session.Topic(), session.Uuid(), session.GetInbound(),
 			OutputDeliverer(p.deliverToOutput), p.context)
 		session.Attrs().Add("@Driver.Cost."+driName, time.Since(start))
 
@@ -438,10 +625,91 @@ func (p *Pipeline) doDriver(session *session) {
 			"error": "DRIVER_NOT_FOUND",
 		})
 	}
-	// 返回处理结果
+	// 响应拦截器处理后返回处理结果
+	if nil != outbound {
+		outbound = p.doOutboundInterceptor(session, outbound)
+	}
 	session.WriteOutbound(outbound)
 }
 
+// 处理响应拦截过程，按优先级依次处理Driver的响应数据
+func (p *Pipeline) doOutboundInterceptor(session *session, outbound *MessagePacket) *MessagePacket {
+	hits := p.routes().outbounds.match(session.tokens)
+	if 0 == len(hits) {
+		return outbound
+	}
+	sort.SliceStable(hits, func(i, j int) bool {
+		return hits[i].value.(OutboundInterceptor).GetPriority() > hits[j].value.(OutboundInterceptor).GetPriority()
+	})
+	for _, hit := range hits {
+		// 过滤表达式作用于前序拦截器处理后的响应消息
+		if whereOf(hit.value).Match(hit.attrs(session), outbound) {
+			outbound = p.handleOutbound(session, hit, outbound)
+		}
+	}
+	return outbound
+}
+
+func (p *Pipeline) handleOutbound(session *session, hit topicMatch, outbound *MessagePacket) (ret *MessagePacket) {
+	it := hit.value.(OutboundInterceptor)
+	itName := it.GetName()
+	ret = outbound
+	defer func() {
+		if r := recover(); nil != r {
+			ret = outbound
+			p.checkRecover(r, "OutboundInterceptor内部错误: "+itName)
+		}
+	}()
+	start := time.Now()
+	out, err := it.HandleOutbound(hit.attrs(session), session.Topic(), session.Uuid(), session.GetInbound(), outbound, p.context)
+	session.Attrs().Add("@OutboundInterceptor.Cost."+itName, time.Since(start))
+	if nil != err {
+		p.failFastLogger("响应拦截器发生错误("+itName+"): ", err)
+	} else if nil != out {
+		ret = out
+	}
+	return ret
+}
+
+// 聚合模式：并发执行全部Driver，使用合并函数合并返回数据
+func (p *Pipeline) aggregateDrivers(session *session, drivers []topicMatch) *MessagePacket {
+	results := make([]DriverResult, len(drivers))
+	wg := new(sync.WaitGroup)
+	wg.Add(len(drivers))
+	for i, hit := range drivers {
+		go func(i int, hit topicMatch) {
+			driver := hit.value.(Driver)
+			driName := driver.GetName()
+			defer wg.Done()
+			defer func() {
+				if r := recover(); nil != r {
+					results[i] = DriverResult{Name: driName, Err: errors.Errorf("Driver内部错误: %v", r)}
+					p.checkRecover(r, "Driver-Goroutine内部错误: "+driName)
+				}
+			}()
+			log.Debugf("用户驱动正在处理(聚合), Driver: %s, topic: %s", driName, session.Topic())
+			start := time.Now()
+			ret, err := driver.Drive(
+				hit.attrs(session), session.Topic(), session.Uuid(), session.GetInbound(),
+				OutputDeliverer(p.deliverToOutput), p.context)
+			session.Attrs().Add("@Driver.Cost."+driName, time.Since(start))
+			if nil == err && nil == ret {
+				err = errors.New("返回空数据")
+			}
+			if nil != err {
+				p.failFastLogger("用户驱动发生错误("+driName+"): ", err)
+			}
+			results[i] = DriverResult{Name: driName, Outbound: ret, Err: err}
+		}(i, hit)
+	}
+	wg.Wait()
+	merger := p.driverMerger
+	if nil == merger {
+		merger = mergeDriverFields
+	}
+	return merger(results)
+}
+
 // 处理驱动执行过程
 func (p *Pipeline) doTrigger(session *session) {
 	topic := session.Topic()
@@ -449,28 +717,29 @@ func (p *Pipeline) doTrigger(session *session) {
 		log.Debugf("正在Trigger调度过程，Topic: %s", topic)
 	})
 	// 查找匹配的用户触发器, 并发处理
-	for el := p.triggers.Front(); el != nil; el = el.Next() {
-		trigger := el.Value.(Trigger)
-		if anyTopicMatches(trigger.GetTopicExpr(), topic) {
-			go func() {
-				defer func() {
-					p.checkRecover(recover(), "Trigger-Goroutine内部错误: "+trigger.GetName())
-				}()
-				// Driver 处理
-				log.Debugf("用户触发器正在处理, Trigger: %s, topic: %s", trigger.GetName(), topic)
-				err := trigger.Touch(session.Attrs(), session.Topic(), session.Uuid(), session.GetInbound(),
-					OutputDeliverer(p.deliverToOutput), p.context)
-				if nil != err {
-					p.failFastLogger("用户触发器发生错误("+trigger.GetName()+"): ", err)
-				}
-			}()
-		} else {
-			p.context.OnIfLogV(func() {
-				log.Debugf("用户触发器[未匹配], Trigger: %s, topic: %s", trigger.GetName(), topic)
-			})
+	hits := p.routes().triggers.match(session.tokens)
+	p.context.OnIfLogV(func() {
+		log.Debugf("Topic匹配用户触发器数量: %d, topic: %s", len(hits), topic)
+	})
+	for _, hit := range hits {
+		attrs := hit.attrs(session)
+		if !whereOf(hit.value).Match(attrs, session.GetInbound()) {
+			continue
 		}
+		trigger := hit.value.(Trigger)
+		go func() {
+			defer func() {
+				p.checkRecover(recover(), "Trigger-Goroutine内部错误: "+trigger.GetName())
+			}()
+			// Driver 处理
+			log.Debugf("用户触发器正在处理, Trigger: %s, topic: %s", trigger.GetName(), topic)
+			err := trigger.Touch(attrs, session.Topic(), session.Uuid(), session.GetInbound(),
+				OutputDeliverer(p.deliverToOutput), p.context)
+			if nil != err {
+				p.failFastLogger("用户触发器发生错误("+trigger.GetName()+"): ", err)
+			}
+		}()
 	}
-
 }
 
 func (p *Pipeline) checkDefTimeout(msg string, fn func(Context)) {
@@ -515,9 +784,9 @@ func (p *Pipeline) callStartFunc(component interface{}) {
 	}
 }
 
-func anyTopicMatches(expected []*TopicExpr, topic string) bool {
+func anyTopicMatches(expected []*TopicExpr, topic topicTokens) bool {
 	for _, t := range expected {
-		if t.matches(topic) {
+		if t.matchTokens(topic) {
 			return true
 		}
 	}
@@ -0,0 +1,512 @@
+package gecko
+
+import (
+	"errors"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"testing"
+	"time"
+)
+
+// 创建不依赖配置文件的Pipeline，用于测试调度过程
+func newTestPipeline() *Pipeline {
+	p := &Pipeline{Register: newRegister()}
+	p.prepareEnv()
+	p.context = &_GeckoContext{
+		cfgGeckos:    make(map[string]interface{}),
+		cfgGlobals:   make(map[string]interface{}),
+		scopedKV:     make(map[interface{}]interface{}),
+		stateStore:   NewMemoryStateStore(),
+		plugins:      p.plugins,
+		interceptors: p.interceptors,
+		outbounds:    p.outbounds,
+		drivers:      p.drivers,
+		triggers:     p.triggers,
+		outputs:      p.outputs,
+		inputs:       p.inputs,
+	}
+	p.context.prepare()
+	p.context.(*_GeckoContext).publisher = newPipelinePublisher(p, map[string]interface{}{})
+	p.interceptorChan = make(chan *session, 1)
+	p.driverChan = make(chan *session, 1)
+	p.triggerChan = make(chan *session, 1)
+	return p
+}
+
+func newTestSession(topic string, inbound *MessagePacket) *session {
+	return &session{
+		attrs:     newMapAttributesWith(map[string]interface{}{}),
+		timestamp: time.Now(),
+		topic:     topic,
+		tokens:    tokenizeTopic(topic),
+		uuid:      "test-uuid",
+		inbound:   inbound,
+		outbound:  make(chan *MessagePacket, 1),
+	}
+}
+
+type annotateDriver struct {
+	*AbcDriver
+}
+
+func (d *annotateDriver) Drive(attrs Attributes, topic string, uuid string, in *MessagePacket, fn OutputDeliverer, ctx Context) (*MessagePacket, error) {
+	for i := 0; i < 100; i++ {
+		in.AddField("driver", i)
+		_ = in.SetFieldPath("nested.driver", i)
+		_, _ = in.GetFieldPath("nested.trigger")
+		_, _ = JSONDefaultEncoder(in)
+		attrs.Add("driver", i)
+		in.SetFrames([]byte{byte(i)})
+	}
+	return in.Clone(), nil
+}
+
+type annotateTrigger struct {
+	*AbcTrigger
+	wg *sync.WaitGroup
+	id int
+}
+
+func (t *annotateTrigger) Touch(attrs Attributes, topic string, uuid string, in *MessagePacket, fn OutputDeliverer, ctx Context) error {
+	defer t.wg.Done()
+	key := fmt.Sprintf("trigger-%d", t.id)
+	for i := 0; i < 100; i++ {
+		in.AddField(key, i)
+		_ = in.SetFieldPath("nested.trigger", i)
+		_ = in.SetFieldPath("nested.list[1]", i)
+		in.RangeFields(func(name string, value interface{}) {
+			in.GetFieldOrNil(name)
+		})
+		// 读取嵌套对象的同时，其它Trigger在写入相同的嵌套字段
+		if nested, ok := in.GetFieldMap("nested"); ok {
+			for _, v := range nested {
+				if list, ok := v.([]interface{}); ok {
+					_ = fmt.Sprint(list...)
+				}
+			}
+		}
+		_, _ = JSONDefaultEncoder(in)
+		_ = in.GetFrames()
+		_ = attrs.Map()
+		attrs.Add(key, i)
+	}
+	return nil
+}
+
+func TestMessagePacketSharedByDriverAndTriggers(t *testing.T) {
+	p := newTestPipeline()
+	driver := &annotateDriver{AbcDriver: NewAbcDriver()}
+	driver.setName("annotateDriver")
+	driver.setTopics([]string{"/test/#"})
+	p.AddDriver(driver)
+
+	wg := new(sync.WaitGroup)
+	const triggers = 8
+	for i := 0; i < triggers; i++ {
+		trigger := &annotateTrigger{AbcTrigger: NewAbcTrigger(), wg: wg, id: i}
+		trigger.setName(fmt.Sprintf("annotateTrigger-%d", i))
+		trigger.setTopics([]string{"/test/+"})
+		p.AddTrigger(trigger)
+	}
+	wg.Add(triggers)
+
+	s := newTestSession("/test/race", NewMessagePacketFields(map[string]interface{}{
+		"card":   "12345",
+		"nested": map[string]interface{}{"list": []interface{}{0, 0}},
+	}))
+	go p.doDriver(s)
+	go p.doTrigger(s)
+
+	out := <-s.outbound
+	wg.Wait()
+
+	assert.Equal(t, 99, out.GetFieldOrNil("driver"))
+	for i := 0; i < triggers; i++ {
+		assert.Equal(t, 99, s.GetInbound().GetFieldOrNil(fmt.Sprintf("trigger-%d", i)))
+		assert.True(t, s.Attrs().HasAttr(fmt.Sprintf("trigger-%d", i)))
+	}
+	v, _ := s.GetInbound().GetFieldPath("nested.list[1]")
+	assert.Equal(t, 99, v)
+}
+
+type topicVarsDriver struct {
+	*AbcDriver
+}
+
+func (d *topicVarsDriver) Drive(attrs Attributes, topic string, uuid string, in *MessagePacket, fn OutputDeliverer, ctx Context) (*MessagePacket, error) {
+	building, _ := GetTopicVar(attrs, "building")
+	door, _ := GetTopicVar(attrs, "door")
+	return NewMessagePacketFields(map[string]interface{}{"building": building, "door": door}), nil
+}
+
+func TestTopicVarsCapturedIntoAttributes(t *testing.T) {
+	p := newTestPipeline()
+	driver := &topicVarsDriver{AbcDriver: NewAbcDriver()}
+	driver.setName("topicVarsDriver")
+	driver.setTopics([]string{"/site/{building}/door/{door}/swipe"})
+	p.AddDriver(driver)
+
+	s := newTestSession("/site/B3/door/12/swipe", NewMessagePacketFields(map[string]interface{}{}))
+	p.doInterceptor(s)
+	p.doDriver(<-p.driverChan)
+	<-p.triggerChan
+
+	out := <-s.outbound
+	assert.Equal(t, "B3", out.GetFieldOrNil("building"))
+	assert.Equal(t, "12", out.GetFieldOrNil("door"))
+	// 捕获值只提供给选中的组件，不写入Session属性
+	assert.False(t, s.Attrs().HasAttr(TopicVarsAttrKey))
+}
+
+type topicVarsInterceptor struct {
+	*AbcInterceptor
+	door string
+}
+
+func (it *topicVarsInterceptor) Handle(attrs Attributes, topic string, uuid string, in *MessagePacket, ctx Context) error {
+	it.door, _ = GetTopicVar(attrs, "door")
+	return it.Next()
+}
+
+// 不同组件使用同名的命名通配符匹配不同层级时，各自读取选中自己的表达式捕获的值
+func TestTopicVarsScopedPerComponent(t *testing.T) {
+	p := newTestPipeline()
+	it := &topicVarsInterceptor{AbcInterceptor: NewAbcInterceptor()}
+	it.setName("siteInterceptor")
+	it.setTopics([]string{"/{door}/#"})
+	p.AddInterceptor(it)
+	// where过滤不满足的组件不提供捕获值
+	skipped := &topicVarsInterceptor{AbcInterceptor: NewAbcInterceptor()}
+	skipped.setName("skippedInterceptor")
+	skipped.setTopics([]string{"/+/+/{door}"})
+	skipped.setWhere(newWhereExprForTest(t, `vars.door == "12"`))
+	p.AddInterceptor(skipped)
+
+	driver := &topicVarsDriver{AbcDriver: NewAbcDriver()}
+	driver.setName("doorDriver")
+	driver.setTopics([]string{"/door/{door}/open"})
+	driver.setWhere(newWhereExprForTest(t, `vars.door == "12"`))
+	p.AddDriver(driver)
+
+	s := newTestSession("/door/12/open", NewMessagePacketFields(map[string]interface{}{}))
+	p.doInterceptor(s)
+	p.doDriver(<-p.driverChan)
+	<-p.triggerChan
+
+	assert.Equal(t, "door", it.door)
+	assert.Equal(t, "", skipped.door)
+	out := <-s.outbound
+	assert.Equal(t, "12", out.GetFieldOrNil("door"))
+	assert.Equal(t, "", out.GetFieldOrNil("building"))
+}
+
+func newWhereExprForTest(t *testing.T, expr string) *WhereExpr {
+	where, err := ParseWhereExpr(expr)
+	assert.NoError(t, err)
+	return where
+}
+
+func TestDriverSelectedByWhereFilter(t *testing.T) {
+	p := newTestPipeline()
+	for _, c := range []struct{ name, where string }{
+		{"entryDriver", `direction == "in"`},
+		{"exitDriver", `direction == "out"`},
+		{"defaultDriver", ""},
+	} {
+		driver := &topicVarsDriver{AbcDriver: NewAbcDriver()}
+		driver.setName(c.name)
+		driver.setTopics([]string{"/site/{building}/door/{door}/swipe"})
+		if "" != c.where {
+			where, err := ParseWhereExpr(c.where)
+			assert.NoError(t, err)
+			driver.setWhere(where)
+		}
+		p.AddDriver(driver)
+	}
+	for direction, expected := range map[string]string{"in": "entryDriver", "out": "exitDriver", "": "defaultDriver"} {
+		s := newTestSession("/site/B3/door/12/swipe", NewMessagePacketFields(map[string]interface{}{"direction": direction}))
+		p.doDriver(s)
+		<-s.outbound
+		v, _ := s.Attrs().Get("@Driver.Cost." + expected)
+		assert.NotNil(t, v, direction)
+	}
+}
+
+type fixedDriver struct {
+	*AbcDriver
+	fields map[string]interface{}
+	err    error
+}
+
+func (d *fixedDriver) Drive(attrs Attributes, topic string, uuid string, in *MessagePacket, fn OutputDeliverer, ctx Context) (*MessagePacket, error) {
+	if nil != d.err {
+		return nil, d.err
+	}
+	return NewMessagePacketFields(d.fields), nil
+}
+
+func addFixedDriver(p *Pipeline, name string, priority int, topics []string, fields map[string]interface{}, err error) *fixedDriver {
+	driver := &fixedDriver{AbcDriver: NewAbcDriver(), fields: fields, err: err}
+	driver.setName(name)
+	driver.setPriority(priority)
+	if len(topics) > 0 {
+		driver.setTopics(topics)
+	}
+	p.AddDriver(driver)
+	return driver
+}
+
+func driveTestSession(p *Pipeline, topic string) *MessagePacket {
+	s := newTestSession(topic, NewMessagePacketFields(map[string]interface{}{}))
+	p.doDriver(s)
+	return <-s.outbound
+}
+
+func TestDriverPriorityAndFallback(t *testing.T) {
+	p := newTestPipeline()
+	p.prepareDriverStrategy(map[string]interface{}{"driverStrategy": DriverStrategyPriority})
+	addFixedDriver(p, "low", 1, []string{"/door/#"}, map[string]interface{}{"by": "low"}, nil)
+	addFixedDriver(p, "high", 10, []string{"/door/+"}, map[string]interface{}{"by": "high"}, nil)
+	fallback := addFixedDriver(p, "fallback", 0, nil, map[string]interface{}{"by": "fallback"}, nil)
+	p.SetFallbackDriver(fallback)
+
+	assert.Equal(t, "high", driveTestSession(p, "/door/1").GetFieldOrNil("by"))
+	assert.Equal(t, "low", driveTestSession(p, "/door/1/2").GetFieldOrNil("by"))
+	assert.Equal(t, "fallback", driveTestSession(p, "/user/1").GetFieldOrNil("by"))
+}
+
+func TestFallbackDriverConfig(t *testing.T) {
+	factory := func() interface{} {
+		return &fixedDriver{AbcDriver: NewAbcDriver(), fields: map[string]interface{}{"by": "fallback"}}
+	}
+	p := newTestPipeline()
+	p.AddFactory("FixedDriver", factory)
+	p.register0("fallback", map[string]interface{}{
+		"type":     "FixedDriver",
+		"fallback": true,
+		"where":    "card != null",
+	})
+	assert.NotNil(t, whereOf(p.fallbackDriver))
+	assert.Equal(t, "DRIVER_NOT_FOUND", driveTestSession(p, "/user/1").GetFieldOrNil("error"))
+	s := newTestSession("/user/1", NewMessagePacketFields(map[string]interface{}{"card": "123"}))
+	p.doDriver(s)
+	assert.Equal(t, "fallback", (<-s.outbound).GetFieldOrNil("by"))
+
+	// Fallback Driver不能配置topics
+	assert.Panics(t, func() {
+		p := newTestPipeline()
+		p.AddFactory("FixedDriver", factory)
+		p.register0("fallback", map[string]interface{}{
+			"type":     "FixedDriver",
+			"fallback": true,
+			"topics":   []interface{}{"/user/#"},
+		})
+	})
+}
+
+func TestDriverAggregate(t *testing.T) {
+	p := newTestPipeline()
+	p.prepareDriverStrategy(map[string]interface{}{"driverStrategy": DriverStrategyAggregate})
+	addFixedDriver(p, "lock", 10, []string{"/door/+"}, map[string]interface{}{"lock": "open", "state": "ok"}, nil)
+	addFixedDriver(p, "camera", 5, []string{"/door/+"}, map[string]interface{}{"photo": "1.jpg", "state": "pending"}, nil)
+	addFixedDriver(p, "audit", 1, []string{"/door/+"}, nil, errors.New("offline"))
+
+	out := driveTestSession(p, "/door/1")
+	assert.Equal(t, "open", out.GetFieldOrNil("lock"))
+	assert.Equal(t, "1.jpg", out.GetFieldOrNil("photo"))
+	assert.Equal(t, "ok", out.GetFieldOrNil("state"))
+	assert.Equal(t, map[string]interface{}{"audit": "offline"}, out.GetFieldOrNil("errors"))
+	assert.False(t, out.HasField("error"))
+
+	p.AddDriverMerger("count", func(results []DriverResult) *MessagePacket {
+		return NewMessagePacketFields(map[string]interface{}{"count": len(results)})
+	})
+	p.prepareDriverStrategy(map[string]interface{}{"driverStrategy": DriverStrategyAggregate, "driverMerge": "count"})
+	assert.Equal(t, 3, driveTestSession(p, "/door/1").GetFieldOrNil("count"))
+
+	named := mergeDriverNamed([]DriverResult{
+		{Name: "lock", Outbound: NewMessagePacketFields(map[string]interface{}{"lock": "open"})},
+		{Name: "audit", Err: errors.New("offline")},
+	})
+	assert.Equal(t, map[string]interface{}{"lock": "open"}, named.GetFieldOrNil("lock"))
+	assert.Equal(t, map[string]interface{}{"error": "offline"}, named.GetFieldOrNil("audit"))
+
+	first := mergeDriverFirst([]DriverResult{{Name: "audit", Err: errors.New("offline")}})
+	assert.Equal(t, "offline", first.GetFieldOrNil("error"))
+}
+
+func TestOnewayInputSkipsDriverAndEncoder(t *testing.T) {
+	p := newTestPipeline()
+	addFixedDriver(p, "telemetry", 0, []string{"/sensor/+"}, map[string]interface{}{}, nil)
+	input := NewAbcInputDevice()
+	input.setUuid("SENSOR-1")
+	input.setTopic("/sensor/1")
+	input.setMode(InputModeOneway)
+	input.setDecoder(JSONDefaultDecoder)
+	// 单向模式不调用Encoder
+	input.setEncoder(func(*MessagePacket) (FramePacket, error) {
+		panic("encoder must not be invoked")
+	})
+
+	out, err := p.newInputDeliverer(input).Deliver("/sensor/1", FramePacket(`{"temperature": 21}`))
+	assert.NoError(t, err)
+	assert.Nil(t, out)
+
+	s := <-p.interceptorChan
+	assert.True(t, s.oneway)
+	p.doInterceptor(s)
+	assert.Equal(t, s, <-p.triggerChan)
+	assert.Equal(t, 0, len(p.driverChan))
+	assert.Equal(t, InputModeRequest, NewAbcInputDevice().GetMode())
+}
+
+type funcInterceptor struct {
+	*AbcInterceptor
+	handle func(it *funcInterceptor, in *MessagePacket) error
+}
+
+func (fi *funcInterceptor) Handle(attrs Attributes, topic string, uuid string, in *MessagePacket, ctx Context) error {
+	return fi.handle(fi, in)
+}
+
+func addFuncInterceptor(p *Pipeline, name string, priority int, handle func(it *funcInterceptor, in *MessagePacket) error) *funcInterceptor {
+	it := &funcInterceptor{AbcInterceptor: NewAbcInterceptor(), handle: handle}
+	it.setName(name)
+	it.setPriority(priority)
+	it.setTopics([]string{"/door/#"})
+	p.AddInterceptor(it)
+	return it
+}
+
+func TestInterceptorReplaceInbound(t *testing.T) {
+	p := newTestPipeline()
+	addFuncInterceptor(p, "normalize", 10, func(it *funcInterceptor, in *MessagePacket) error {
+		return it.Replace(NewMessagePacketFields(map[string]interface{}{"card": in.GetFieldOrNil("CardNo")}))
+	})
+	addFuncInterceptor(p, "check", 0, func(it *funcInterceptor, in *MessagePacket) error {
+		if nil == in.GetFieldOrNil("card") {
+			return it.Drop()
+		}
+		return it.Next()
+	})
+	// 过滤表达式按替换后的Inbound消息判断
+	audit := addFuncInterceptor(p, "audit", -10, func(it *funcInterceptor, in *MessagePacket) error {
+		in.AddField("audited", true)
+		return it.Next()
+	})
+	audit.setWhere(newWhereExprForTest(t, `card == "123" && CardNo == null`))
+	s := newTestSession("/door/1", NewMessagePacketFields(map[string]interface{}{"CardNo": "123"}))
+	p.doInterceptor(s)
+	assert.Equal(t, s, <-p.driverChan)
+	assert.Equal(t, s, <-p.triggerChan)
+	assert.Equal(t, "123", s.GetInbound().GetFieldOrNil("card"))
+	assert.Equal(t, true, s.GetInbound().GetFieldOrNil("audited"))
+	assert.Equal(t, []string{"normalize"}, s.Attrs().GetOrNil(InterceptorReplacedAttrKey))
+}
+
+func TestInterceptorDropReplyAndErrorPolicy(t *testing.T) {
+	p := newTestPipeline()
+	addFuncInterceptor(p, "blacklist", 10, func(it *funcInterceptor, in *MessagePacket) error {
+		switch in.GetFieldOrNil("card") {
+		case "999":
+			return it.DropWith("BLACKLIST")
+		case "888":
+			return it.Reply(NewMessagePacketFields(map[string]interface{}{"door": "open"}))
+		}
+		return it.Next()
+	})
+	failing := addFuncInterceptor(p, "failing", 0, func(it *funcInterceptor, in *MessagePacket) error {
+		return errors.New("SERVICE_DOWN")
+	})
+
+	s := newTestSession("/door/1", NewMessagePacketFields(map[string]interface{}{"card": "999"}))
+	p.doInterceptor(s)
+	out := <-s.outbound
+	assert.Equal(t, "INTERCEPTOR_DROPPED", out.GetFieldOrNil("error"))
+	assert.Equal(t, "BLACKLIST", out.GetFieldOrNil("reason"))
+	assert.Equal(t, "blacklist", s.Attrs().GetOrNil(InterceptorDroppedAttrKey))
+	assert.Equal(t, "BLACKLIST", s.Attrs().GetOrNil(InterceptorReasonAttrKey))
+	assert.Equal(t, 0, len(p.driverChan))
+	assert.Equal(t, 0, len(p.triggerChan))
+
+	s = newTestSession("/door/1", NewMessagePacketFields(map[string]interface{}{"card": "888"}))
+	p.doInterceptor(s)
+	assert.Equal(t, "open", (<-s.outbound).GetFieldOrNil("door"))
+	assert.Equal(t, "blacklist", s.Attrs().GetOrNil(InterceptorRepliedAttrKey))
+	assert.Equal(t, 0, len(p.driverChan))
+
+	// 默认记录错误后继续处理
+	s = newTestSession("/door/1", NewMessagePacketFields(map[string]interface{}{"card": "123"}))
+	p.doInterceptor(s)
+	assert.Equal(t, s, <-p.driverChan)
+	assert.Equal(t, s, <-p.triggerChan)
+	assert.Equal(t, map[string]string{"failing": "SERVICE_DOWN"}, s.Attrs().GetOrNil(InterceptorErrorsAttrKey))
+
+	failing.setErrorPolicy(InterceptorOnErrorAbort)
+	s = newTestSession("/door/1", NewMessagePacketFields(map[string]interface{}{"card": "123"}))
+	p.doInterceptor(s)
+	out = <-s.outbound
+	assert.Equal(t, "INTERCEPTOR_ERROR", out.GetFieldOrNil("error"))
+	assert.Equal(t, "SERVICE_DOWN", out.GetFieldOrNil("reason"))
+	assert.Equal(t, "failing", s.Attrs().GetOrNil(InterceptorAbortedAttrKey))
+	assert.Equal(t, 0, len(p.driverChan))
+	assert.Equal(t, 0, len(p.triggerChan))
+}
+
+type funcOutboundInterceptor struct {
+	*AbcOutboundInterceptor
+	handle func(out *MessagePacket) (*MessagePacket, error)
+}
+
+func (fo *funcOutboundInterceptor) HandleOutbound(attrs Attributes, topic string, uuid string, in *MessagePacket, out *MessagePacket, ctx Context) (*MessagePacket, error) {
+	return fo.handle(out)
+}
+
+func addFuncOutboundInterceptor(p *Pipeline, name string, priority int, where string, handle func(out *MessagePacket) (*MessagePacket, error)) {
+	it := &funcOutboundInterceptor{AbcOutboundInterceptor: NewAbcOutboundInterceptor(), handle: handle}
+	it.setName(name)
+	it.setPriority(priority)
+	it.setTopics([]string{"/door/#"})
+	if "" != where {
+		expr, _ := ParseWhereExpr(where)
+		it.setWhere(expr)
+	}
+	p.AddOutboundInterceptor(it)
+}
+
+func TestOutboundInterceptorChain(t *testing.T) {
+	p := newTestPipeline()
+	addFixedDriver(p, "door", 0, []string{"/door/+"}, map[string]interface{}{"result": "open", "pin": "1234"}, nil)
+	// 按优先级从高到低执行：脱敏 -> 出错 -> 恐慌 -> 签名
+	addFuncOutboundInterceptor(p, "sign", 0, "", func(out *MessagePacket) (*MessagePacket, error) {
+		return NewMessagePacketFields(map[string]interface{}{
+			"payload": out.GetFields(), "sign": fmt.Sprintf("%v", out.GetFieldOrNil("result")),
+		}), nil
+	})
+	addFuncOutboundInterceptor(p, "mask", 30, "pin != null", func(out *MessagePacket) (*MessagePacket, error) {
+		out.AddField("pin", "****")
+		return nil, nil
+	})
+	addFuncOutboundInterceptor(p, "failing", 20, "", func(out *MessagePacket) (*MessagePacket, error) {
+		return NewMessagePacket(), errors.New("AUDIT_DOWN")
+	})
+	addFuncOutboundInterceptor(p, "panic", 10, "", func(out *MessagePacket) (*MessagePacket, error) {
+		panic("outbound interceptor panic")
+	})
+	addFuncOutboundInterceptor(p, "skipped", 5, "result == 'closed'", func(out *MessagePacket) (*MessagePacket, error) {
+		return NewMessagePacket(), nil
+	})
+
+	s := newTestSession("/door/1", NewMessagePacketFields(map[string]interface{}{}))
+	p.doDriver(s)
+	out := <-s.outbound
+	assert.Equal(t, "open", out.GetFieldOrNil("sign"))
+	assert.Equal(t, map[string]interface{}{"result": "open", "pin": "****"}, out.GetFieldOrNil("payload"))
+	assert.True(t, s.Attrs().HasAttr("@OutboundInterceptor.Cost.sign"))
+	assert.False(t, s.Attrs().HasAttr("@OutboundInterceptor.Cost.skipped"))
+
+	// 未匹配Driver的响应同样经过响应拦截器
+	out = driveTestSession(p, "/door/1/2")
+	assert.Equal(t, map[string]interface{}{"error": "DRIVER_NOT_FOUND"}, out.GetFieldOrNil("payload"))
+}
@@ -0,0 +1,108 @@
+package gecko
+
+import (
+	"errors"
+	"github.com/yoojia/go-value"
+	"time"
+)
+
+//
+// Author: 陈哈哈 chenyongjia@parkingwang.com, yoojiachen@gmail.com
+//
+
+var (
+	// 发布事件的跳数超过限制，通常是组件之间循环发布事件
+	ErrPublishLoop = errors.New("PUBLISH_LOOP_DETECTED")
+	// 同步发布事件等待处理结果超时
+	ErrPublishTimeout = errors.New("PUBLISH_TIMEOUT")
+	// Pipeline已停止，无法发布事件
+	ErrPublishStopped = errors.New("PUBLISH_STOPPED")
+)
+
+// Session属性中保存事件发布跳数的Key。由外部Input产生的事件跳数为0，每发布一次加1。
+const PublishHopsAttrKey = "@Publish.HOPS"
+
+// 默认的事件发布最大跳数，可以通过[GECKO]配置项 publishMaxHops 修改
+const DefaultPublishMaxHops = 8
+
+// Publisher 允许组件发布新的内部事件。事件以指定的Topic、UUID和消息数据创建Session，
+// 与Input设备产生的事件一样，依次经过Interceptor、Driver和Trigger处理。
+type Publisher interface {
+	// 异步发布事件，不等待处理结果。
+	// attrs 为当前处理中的Session属性，用于计算发布跳数以检测循环发布；外部调用时可以为nil。
+	Publish(attrs Attributes, topic string, uuid string, msg *MessagePacket) error
+
+	// 同步发布事件，等待Driver的处理结果，超时返回 ErrPublishTimeout。
+	Request(attrs Attributes, topic string, uuid string, msg *MessagePacket, timeout time.Duration) (*MessagePacket, error)
+}
+
+////
+
+type pipelinePublisher struct {
+	pipeline *Pipeline
+	maxHops  int64
+}
+
+func newPipelinePublisher(pipeline *Pipeline, geckos map[string]interface{}) *pipelinePublisher {
+	maxHops := value.Of(geckos["publishMaxHops"]).Int64OrDefault(DefaultPublishMaxHops)
+	if maxHops <= 0 {
+		maxHops = DefaultPublishMaxHops
+	}
+	return &pipelinePublisher{pipeline: pipeline, maxHops: maxHops}
+}
+
+func (pp *pipelinePublisher) Publish(attrs Attributes, topic string, uuid string, msg *MessagePacket) error {
+	_, err := pp.publish(attrs, topic, uuid, msg)
+	return err
+}
+
+func (pp *pipelinePublisher) Request(attrs Attributes, topic string, uuid string, msg *MessagePacket, timeout time.Duration) (*MessagePacket, error) {
+	session, err := pp.publish(attrs, topic, uuid, msg)
+	if nil != err {
+		return nil, err
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case out := <-session.outbound:
+		return out, nil
+	case <-timer.C:
+		return nil, ErrPublishTimeout
+	case <-pp.pipeline.termCtx.Done():
+		return nil, ErrPublishStopped
+	}
+}
+
+func (pp *pipelinePublisher) publish(attrs Attributes, topic string, uuid string, msg *MessagePacket) (*session, error) {
+	if "" == topic || '/' != topic[0] {
+		return nil, errors.New("发布事件的Topic必须以'/'开头: " + topic)
+	}
+	var hops int64 = 0
+	if nil != attrs {
+		hops, _ = attrs.GetInt64(PublishHopsAttrKey)
+	}
+	if hops >= pp.maxHops {
+		log.Warnw("发布事件跳数超过限制，可能存在循环发布", "topic", topic, "uuid", uuid, "hops", hops)
+		return nil, ErrPublishLoop
+	}
+	if nil == msg {
+		msg = NewMessagePacket()
+	}
+	session := &session{
+		attrs: newMapAttributesWith(map[string]interface{}{
+			PublishHopsAttrKey: hops + 1,
+		}),
+		timestamp: time.Now(),
+		topic:     topic,
+		tokens:    tokenizeTopic(topic),
+		uuid:      uuid,
+		inbound:   msg,
+		outbound:  make(chan *MessagePacket, 1),
+	}
+	select {
+	case pp.pipeline.interceptorChan <- session:
+		return session, nil
+	case <-pp.pipeline.termCtx.Done():
+		return nil, ErrPublishStopped
+	}
+}
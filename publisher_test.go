@@ -0,0 +1,58 @@
+package gecko
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestPublisherPublish(t *testing.T) {
+	p := newTestPipeline()
+	publisher := p.context.Publisher()
+
+	parent := NewAttributesWith(map[string]interface{}{PublishHopsAttrKey: int64(2)})
+	msg := NewMessagePacketFields(map[string]interface{}{"level": "high"})
+	assert.NoError(t, publisher.Publish(parent, "/alarm/raised", "DOOR-1", msg))
+	s := <-p.interceptorChan
+	assert.Equal(t, "/alarm/raised", s.Topic())
+	assert.Equal(t, "DOOR-1", s.Uuid())
+	assert.Equal(t, msg, s.GetInbound())
+	hops, _ := s.Attrs().GetInt64(PublishHopsAttrKey)
+	assert.Equal(t, int64(3), hops)
+
+	assert.NoError(t, publisher.Publish(nil, "/alarm/raised", "", nil))
+	s = <-p.interceptorChan
+	hops, _ = s.Attrs().GetInt64(PublishHopsAttrKey)
+	assert.Equal(t, int64(1), hops)
+
+	assert.Error(t, publisher.Publish(nil, "alarm/raised", "", nil))
+	loop := NewAttributesWith(map[string]interface{}{PublishHopsAttrKey: int64(DefaultPublishMaxHops)})
+	assert.Equal(t, ErrPublishLoop, publisher.Publish(loop, "/alarm/raised", "", nil))
+}
+
+func TestPublisherRequest(t *testing.T) {
+	p := newTestPipeline()
+	addFixedDriver(p, "alarm", 0, []string{"/alarm/+"}, map[string]interface{}{"ack": true}, nil)
+	go func() {
+		for i := 0; i < 2; i++ {
+			p.doInterceptor(<-p.interceptorChan)
+			p.doDriver(<-p.driverChan)
+			<-p.triggerChan
+		}
+	}()
+	out, err := p.context.Publisher().Request(nil, "/alarm/raised", "", nil, time.Second)
+	assert.NoError(t, err)
+	assert.Equal(t, true, out.GetFieldOrNil("ack"))
+
+	out, err = p.context.Publisher().Request(nil, "/other", "", nil, time.Second)
+	assert.NoError(t, err)
+	assert.Equal(t, "DRIVER_NOT_FOUND", out.GetFieldOrNil("error"))
+
+	// 没有调度处理时超时
+	_, err = p.context.Publisher().Request(nil, "/alarm/raised", "", nil, 10*time.Millisecond)
+	assert.Equal(t, ErrPublishTimeout, err)
+
+	// 通道中残留超时的事件，Pipeline停止后发布失败
+	p.termCancel()
+	assert.Equal(t, ErrPublishStopped, p.context.Publisher().Publish(nil, "/alarm/raised", "", nil))
+}
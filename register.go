@@ -17,12 +17,21 @@ type Register struct {
 	uuidInputs    map[string]InputDevice
 	namedDecoders map[string]Decoder
 	namedEncoders map[string]Encoder
-	plugins       *list.List
-	interceptors  *list.List
-	drivers       *list.List
-	triggers      *list.List
-	outputs       *list.List
-	inputs        *list.List
+	inputSchemas  map[string]*Schema
+	topicSchemas  []*topicSchema
+	topicRoutes   TopicRouteSlice
+	driverMergers map[string]DriverMergeFunc
+	// 没有Driver匹配时处理事件的Driver
+	fallbackDriver Driver
+	codecs         *list.List
+	logics         *list.List
+	plugins        *list.List
+	interceptors   *list.List
+	outbounds      *list.List
+	drivers        *list.List
+	triggers       *list.List
+	outputs        *list.List
+	inputs         *list.List
 	// Hooks
 	startBeforeHooks *list.List
 	startAfterHooks  *list.List
@@ -38,8 +47,19 @@ func newRegister() *Register {
 	re.uuidInputs = make(map[string]InputDevice)
 	re.namedDecoders = make(map[string]Decoder)
 	re.namedEncoders = make(map[string]Encoder)
+	re.inputSchemas = make(map[string]*Schema)
+	re.topicSchemas = make([]*topicSchema, 0)
+	re.topicRoutes = make(TopicRouteSlice, 0)
+	re.driverMergers = map[string]DriverMergeFunc{
+		DriverMergeFields: mergeDriverFields,
+		DriverMergeFirst:  mergeDriverFirst,
+		DriverMergeNamed:  mergeDriverNamed,
+	}
+	re.codecs = list.New()
+	re.logics = list.New()
 	re.plugins = list.New()
 	re.interceptors = list.New()
+	re.outbounds = list.New()
 	re.drivers = list.New()
 	re.triggers = list.New()
 	re.inputs = list.New()
@@ -94,16 +114,57 @@ func (re *Register) AddInterceptor(interceptor Interceptor) {
 	re.interceptors.PushBack(interceptor)
 }
 
+// 添加OutboundInterceptor
+func (re *Register) AddOutboundInterceptor(interceptor OutboundInterceptor) {
+	re.outbounds.PushBack(interceptor)
+}
+
 // 添加Driver
 func (re *Register) AddDriver(driver Driver) {
 	re.drivers.PushBack(driver)
 }
 
+// 添加聚合模式下Driver返回数据的合并函数，在[GECKO]配置项 driverMerge 中按名称引用
+func (re *Register) AddDriverMerger(name string, merger DriverMergeFunc) {
+	if _, ok := re.driverMergers[name]; ok {
+		log.Panic("Driver合并函数重复" + name)
+	}
+	re.driverMergers[name] = merger
+}
+
+// 设置没有Driver匹配时处理事件的Driver。Driver需要同时通过AddDriver添加。
+func (re *Register) SetFallbackDriver(driver Driver) {
+	if nil != re.fallbackDriver {
+		log.Panicf("只允许设置一个Fallback Driver，已设置: %s", re.fallbackDriver.GetName())
+	}
+	re.fallbackDriver = driver
+}
+
 // 添加Trigger
 func (re *Register) AddTrigger(trigger Trigger) {
 	re.triggers.PushBack(trigger)
 }
 
+// 添加按Topic匹配的消息校验Schema
+func (re *Register) AddTopicSchema(name string, topics []string, schema *Schema) {
+	ts := &topicSchema{name: name, schema: schema}
+	for _, t := range topics {
+		ts.topics = append(ts.topics, newTopicExpr(t))
+	}
+	re.topicSchemas = append(re.topicSchemas, ts)
+}
+
+// 添加Topic改写规则
+func (re *Register) AddTopicRoute(route *TopicRoute) {
+	re.topicRoutes = append(re.topicRoutes, route)
+	re.topicRoutes.sort()
+}
+
+// 添加指定InputDevice的消息校验Schema
+func (re *Register) AddInputSchema(uuid string, schema *Schema) {
+	re.inputSchemas[uuid] = schema
+}
+
 func (re *Register) AddStartBeforeHook(hook HookFunc) {
 	re.startBeforeHooks.PushBack(hook)
 }
@@ -146,11 +207,21 @@ func (re *Register) showComponents() {
 		log.Infof("  -> Driver: [%s::%s]", utils.GetClassName(it), it.(NeedName).GetName())
 	})
 
+	log.Infof("已加载 OutboundInterceptors: %d", re.outbounds.Len())
+	utils.ForEach(re.outbounds, func(it interface{}) {
+		log.Infof("  -> OutboundInterceptor: [%s::%s]", utils.GetClassName(it), it.(NeedName).GetName())
+	})
+
 	log.Infof("已加载 Triggers: %d", re.triggers.Len())
 	utils.ForEach(re.triggers, func(it interface{}) {
 		log.Infof("  -> Trigger: [%s::%s]", utils.GetClassName(it), it.(NeedName).GetName())
 	})
 
+	log.Infof("已加载 Codecs: %d", re.codecs.Len())
+	utils.ForEach(re.codecs, func(it interface{}) {
+		log.Info("  -> Codec: " + utils.GetClassName(it))
+	})
+
 	log.Infof("已加载 Plugins: %d", re.plugins.Len())
 	utils.ForEach(re.plugins, func(it interface{}) {
 		log.Info("  -> Plugin: " + utils.GetClassName(it))
@@ -259,7 +330,11 @@ func (re *Register) register0(keyAsTypeName string, item interface{}) (interface
 
 	case Driver:
 		driver := component.(Driver)
+		driver.setPriority(int(value.Of(config["priority"]).MustInt64()))
 		re.AddDriver(driver)
+		if value.Of(config["fallback"]).MustBool() {
+			re.SetFallbackDriver(driver)
+		}
 		if "" != name {
 			driver.setName(name)
 		} else {
@@ -278,6 +353,12 @@ func (re *Register) register0(keyAsTypeName string, item interface{}) (interface
 	case Interceptor:
 		it := component.(Interceptor)
 		it.setPriority(int(value.Of(config["priority"]).MustInt64()))
+		if policy := value.Of(config["onError"]).String(); "" != policy {
+			if !isInterceptorErrorPolicy(policy) {
+				log.Panicw("配置项[onError]错误，可选值为 continue / abort", "type", componentType, "onError", policy)
+			}
+			it.setErrorPolicy(policy)
+		}
 		if "" != name {
 			it.setName(name)
 		} else {
@@ -285,6 +366,16 @@ func (re *Register) register0(keyAsTypeName string, item interface{}) (interface
 		}
 		re.AddInterceptor(it)
 
+	case OutboundInterceptor:
+		it := component.(OutboundInterceptor)
+		it.setPriority(int(value.Of(config["priority"]).MustInt64()))
+		if "" != name {
+			it.setName(name)
+		} else {
+			it.setName(keyAsTypeName)
+		}
+		re.AddOutboundInterceptor(it)
+
 	case VirtualDevice:
 		device := component.(VirtualDevice)
 		device.setName(required(name,
@@ -316,7 +407,20 @@ func (re *Register) register0(keyAsTypeName string, item interface{}) (interface
 		if inputDevice, ok := device.(InputDevice); ok {
 			inputDevice.setTopic(required(value.Of(config["topic"]).String(),
 				"VirtualDevice[%s]配置项[topic]是必填参数", componentType))
+			switch mode := value.Of(config["mode"]).String(); mode {
+			case "", InputModeRequest, InputModeOneway:
+				inputDevice.setMode(mode)
+			default:
+				log.Panicw("InputDevice配置项[mode]错误", "uuid", inputDevice.GetUuid(), "mode", mode)
+			}
 			re.AddInputDevice(inputDevice)
+			if sc, ok := config["schema"]; ok {
+				schema, err := ParseSchema(utils.ToMap(sc))
+				if nil != err {
+					log.Panicw("InputDevice配置项[schema]错误", "uuid", inputDevice.GetUuid(), "error", err)
+				}
+				re.AddInputSchema(inputDevice.GetUuid(), schema)
+			}
 		} else if outputDevice, ok := device.(OutputDevice); ok {
 			re.AddOutputDevice(outputDevice)
 		} else {
@@ -343,10 +447,27 @@ func (re *Register) register0(keyAsTypeName string, item interface{}) (interface
 			if err := input.addLogic(logic); nil != err {
 				log.Panic("LogicDevice挂载到MasterInputDevice发生错误", err)
 			}
+			re.logics.PushBack(logic)
 		} else {
 			log.Panicf("LogicDevice[%s]配置项[masterUuid]是没找到对应设备", componentType)
 		}
 
+	case DecoderComponent:
+		decoder := component.(DecoderComponent)
+		if "" == name {
+			name = keyAsTypeName
+		}
+		re.AddDecoder(name, Decoder(decoder.Decode))
+		re.codecs.PushBack(decoder)
+
+	case EncoderComponent:
+		encoder := component.(EncoderComponent)
+		if "" == name {
+			name = keyAsTypeName
+		}
+		re.AddEncoder(name, Encoder(encoder.Encode))
+		re.codecs.PushBack(encoder)
+
 	default:
 		if plg, ok := component.(Plugin); ok {
 			re.AddPlugin(plg)
@@ -355,18 +476,70 @@ func (re *Register) register0(keyAsTypeName string, item interface{}) (interface
 		}
 	}
 
-	// Interceptor / Driver 需要Topic过滤
+	// Interceptor / OutboundInterceptor / Driver 需要Topic过滤；Fallback Driver只在没有Driver匹配时使用，不能配置Topic
 	if tf, ok := component.(NeedTopicFilter); ok {
-		if topics := utils.ToStringArray(config["topics"]); 0 == len(topics) {
+		topics := utils.ToStringArray(config["topics"])
+		switch {
+		case component == re.fallbackDriver:
+			if _, ok := config["topics"]; ok {
+				log.Panicw("Fallback Driver不参与Topic匹配，不能配置[topics]", "type", componentType)
+			}
+		case 0 == len(topics):
 			log.Panicw("配置项中[topics]必须是字符串数组", "type", componentType)
-		} else {
+		default:
 			tf.setTopics(topics)
 		}
 	}
+	// Interceptor / OutboundInterceptor / Driver / Trigger 可选的消息内容过滤
+	if wf, ok := component.(NeedWhereFilter); ok {
+		if where := value.Of(config["where"]).String(); "" != where {
+			expr, err := ParseWhereExpr(where)
+			if nil != err {
+				log.Panicw("配置项[where]错误", "type", componentType, "where", where, "error", err)
+			}
+			wf.setWhere(expr)
+		}
+	}
 
 	return component, config
 }
 
+// 注册[SCHEMAS]配置的按Topic匹配的校验Schema
+func (re *Register) registerSchemas(configs map[string]interface{}) {
+	for name, item := range configs {
+		config := utils.ToMap(item)
+		if value.Of(config["disable"]).MustBool() {
+			log.Infof("Schema[%s]在配置中禁用", name)
+			continue
+		}
+		topics := utils.ToStringArray(config["topics"])
+		if 0 == len(topics) {
+			log.Panicw("Schema配置项中[topics]必须是字符串数组", "name", name)
+		}
+		schema, err := ParseSchema(utils.ToMap(config["schema"]))
+		if nil != err {
+			log.Panicw("Schema配置项[schema]错误", "name", name, "error", err)
+		}
+		re.AddTopicSchema(name, topics, schema)
+	}
+}
+
+// 注册[ROUTES]配置的Topic改写规则
+func (re *Register) registerRoutes(configs map[string]interface{}) {
+	for name, item := range configs {
+		config := utils.ToMap(item)
+		if value.Of(config["disable"]).MustBool() {
+			log.Infof("Route[%s]在配置中禁用", name)
+			continue
+		}
+		route, err := ParseTopicRoute(name, config)
+		if nil != err {
+			log.Panicw("Route配置项错误", "name", name, "error", err)
+		}
+		re.AddTopicRoute(route)
+	}
+}
+
 func required(value, template string, args ...interface{}) string {
 	if "" == value {
 		log.Panicf(template, args...)
@@ -0,0 +1,200 @@
+package gecko
+
+import (
+	"github.com/pkg/errors"
+	"github.com/yoojia/go-gecko/v2/utils"
+	"github.com/yoojia/go-value"
+	"sort"
+	"strings"
+)
+
+//
+// Author: 陈哈哈 chenyongjia@parkingwang.com, yoojiachen@gmail.com
+//
+
+// Session属性中保存改写前原始Topic的Key
+const TopicOriginAttrKey = "@Topic.ORIGIN"
+
+// Session属性中保存生效的Topic改写规则名称的Key
+const TopicRouteAttrKey = "@Topic.ROUTE"
+
+// [ROUTES]配置的Topic改写规则。在Decode之后、Schema校验之前，将设备Topic改写为系统内部统一的Topic，
+// 更换设备厂商时无需修改Driver等组件的Topic列表。例如：
+//
+//	[ROUTES.vendorX]
+//	  from = "/vendorX/evt/+"
+//	  to = "/access/+/swipe"
+//	  priority = 0               # 可选，多条规则匹配时，优先级高的规则生效
+//	  [ROUTES.vendorX.when]      # 可选，消息字段值全部相等时才改写
+//	    "event.type" = "swipe"
+//
+// 目标Topic中可以引用来源表达式的通配符：
+// "+" 按顺序引用来源中未命名的 "+"；"{name}" 引用来源中同名的命名通配符；"#" 引用来源中 "#" 匹配的全部层级。
+// 不包含通配符的规则即为Topic别名。
+type TopicRoute struct {
+	Name     string
+	From     *TopicExpr
+	To       string
+	Priority int
+	When     map[string]interface{}
+	toLevels []string
+}
+
+// 从配置Map中解析Topic改写规则
+func ParseTopicRoute(name string, config map[string]interface{}) (*TopicRoute, error) {
+	from, err := ParseTopicExpr(value.Of(config["from"]).String())
+	if nil != err {
+		return nil, errors.WithMessage(err, "route: invalid [from]")
+	}
+	route := &TopicRoute{
+		Name:     name,
+		From:     from,
+		To:       value.Of(config["to"]).String(),
+		Priority: int(value.Of(config["priority"]).MustInt64()),
+		When:     utils.ToMap(config["when"]),
+	}
+	if "" == route.To || '/' != route.To[0] {
+		return nil, errors.Errorf("route: [to] must start with '/': %s", route.To)
+	}
+	positional := 0
+	for i, level := range from.levels {
+		if "+" == level && "" == route.fromName(i) {
+			positional++
+		}
+	}
+	route.toLevels = strings.Split(route.To, "/")[1:]
+	for i, level := range route.toLevels {
+		switch {
+		case "" == level:
+			return nil, errors.Errorf("route: [to] contains empty level: %s", route.To)
+		case "#" == level:
+			if i != len(route.toLevels)-1 || !from.multi {
+				return nil, errors.Errorf("route: '#' must be the last level and requires '#' in [from]: %s", route.To)
+			}
+		case "+" == level:
+			if positional--; positional < 0 {
+				return nil, errors.Errorf("route: [to] has more '+' than [from]: %s", route.To)
+			}
+		case strings.ContainsAny(level, "{}"):
+			name, err := topicVarName(level, nil)
+			if nil != err {
+				return nil, errors.WithMessage(err, "route: invalid [to] "+route.To)
+			}
+			if !route.hasFromName(name) {
+				return nil, errors.Errorf("route: [to] references undefined wildcard %s: %s", level, route.To)
+			}
+		case strings.ContainsAny(level, "+#"):
+			return nil, errors.Errorf("route: wildcard must occupy a whole level: %s", route.To)
+		}
+	}
+	return route, nil
+}
+
+func (r *TopicRoute) fromName(i int) string {
+	if r.From.hasNames() {
+		return r.From.names[i]
+	}
+	return ""
+}
+
+func (r *TopicRoute) hasFromName(name string) bool {
+	for i := range r.From.levels {
+		if name == r.fromName(i) {
+			return true
+		}
+	}
+	return false
+}
+
+// 判断消息是否满足改写条件。msg为nil时，只有无条件的规则满足。
+func (r *TopicRoute) accept(msg *MessagePacket) bool {
+	if 0 == len(r.When) {
+		return true
+	}
+	if nil == msg {
+		return false
+	}
+	for path, expected := range r.When {
+		actual, ok := msg.GetFieldPath(path)
+		if !ok || !schemaValueEquals(expected, actual) {
+			return false
+		}
+	}
+	return true
+}
+
+// 按规则改写Topic。Topic与来源表达式不匹配，或者改写后没有任何层级时返回false。
+func (r *TopicRoute) rewrite(topic topicTokens) (string, bool) {
+	if !r.From.matchTokens(topic) {
+		return "", false
+	}
+	positional := make([]string, 0)
+	named := make(map[string]string)
+	for i, level := range r.From.levels {
+		if "+" != level {
+			continue
+		}
+		if name := r.fromName(i); "" != name {
+			named[name] = topic.levels[i]
+		} else {
+			positional = append(positional, topic.levels[i])
+		}
+	}
+	out := make([]string, 0, len(r.toLevels))
+	for _, level := range r.toLevels {
+		switch {
+		case "#" == level:
+			// # 匹配父级时没有剩余层级
+			out = append(out, topic.levels[len(r.From.levels)-1:]...)
+		case "+" == level:
+			out = append(out, positional[0])
+			positional = positional[1:]
+		case '{' == level[0]:
+			out = append(out, named[level[1:len(level)-1]])
+		default:
+			out = append(out, level)
+		}
+	}
+	// 目标为"/#"且 # 匹配父级时没有任何层级，不改写
+	if 0 == len(out) {
+		return "", false
+	}
+	return "/" + strings.Join(out, "/"), true
+}
+
+////
+
+// 按优先级排序的改写规则列表，优先级相同时按名称排序
+type TopicRouteSlice []*TopicRoute
+
+func (rs TopicRouteSlice) Len() int { return len(rs) }
+
+func (rs TopicRouteSlice) Less(i, j int) bool {
+	if rs[i].Priority != rs[j].Priority {
+		return rs[i].Priority > rs[j].Priority
+	}
+	return rs[i].Name < rs[j].Name
+}
+
+func (rs TopicRouteSlice) Swap(i, j int) { rs[i], rs[j] = rs[j], rs[i] }
+
+// 使用第一条匹配的规则改写Topic，规则不会链式生效。没有规则匹配时返回nil。
+func (rs TopicRouteSlice) route(topic string, msg *MessagePacket) (string, *TopicRoute) {
+	if 0 == len(rs) {
+		return topic, nil
+	}
+	tokens := tokenizeTopic(topic)
+	for _, r := range rs {
+		if !r.accept(msg) {
+			continue
+		}
+		if target, ok := r.rewrite(tokens); ok {
+			return target, r
+		}
+	}
+	return topic, nil
+}
+
+func (rs TopicRouteSlice) sort() {
+	sort.Stable(rs)
+}
@@ -0,0 +1,97 @@
+package gecko
+
+import (
+	"github.com/BurntSushi/toml"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+const testRoutesToml = `
+[ROUTES.vendorX]
+  from = "/vendorX/evt/+"
+  to = "/access/+/swipe"
+[ROUTES.vendorY]
+  from = "/vendorY/{site}/reader/{door}/#"
+  to = "/access/{door}/swipe/{site}/#"
+  priority = 10
+[ROUTES.vendorY.when]
+  "event.type" = "swipe"
+  version = 2
+[ROUTES.alias]
+  from = "/legacy/door"
+  to = "/access/0/swipe"
+`
+
+func loadTestRoutes(t *testing.T) TopicRouteSlice {
+	config := make(map[string]interface{})
+	_, err := toml.Decode(testRoutesToml, &config)
+	assert.NoError(t, err)
+	re := newRegister()
+	re.registerRoutes(config["ROUTES"].(map[string]interface{}))
+	return re.topicRoutes
+}
+
+func TestTopicRoutes(t *testing.T) {
+	routes := loadTestRoutes(t)
+	assert.Equal(t, []string{"vendorY", "alias", "vendorX"}, []string{routes[0].Name, routes[1].Name, routes[2].Name})
+
+	topic, route := routes.route("/vendorX/evt/12", nil)
+	assert.Equal(t, "/access/12/swipe", topic)
+	assert.Equal(t, "vendorX", route.Name)
+
+	topic, route = routes.route("/legacy/door", nil)
+	assert.Equal(t, "/access/0/swipe", topic)
+	assert.Equal(t, "alias", route.Name)
+
+	swipe := NewMessagePacketFields(map[string]interface{}{
+		"event":   map[string]interface{}{"type": "swipe"},
+		"version": float64(2),
+	})
+	topic, _ = routes.route("/vendorY/B3/reader/7/in/1", swipe)
+	assert.Equal(t, "/access/7/swipe/B3/in/1", topic)
+	topic, _ = routes.route("/vendorY/B3/reader/7", swipe)
+	assert.Equal(t, "/access/7/swipe/B3", topic)
+
+	// 条件不满足时不改写
+	topic, route = routes.route("/vendorY/B3/reader/7", NewMessagePacketFields(map[string]interface{}{"version": 2}))
+	assert.Equal(t, "/vendorY/B3/reader/7", topic)
+	assert.Nil(t, route)
+	topic, route = routes.route("/vendorY/B3/reader/7", nil)
+	assert.Nil(t, route)
+
+	topic, route = routes.route("/other/topic", nil)
+	assert.Equal(t, "/other/topic", topic)
+	assert.Nil(t, route)
+}
+
+// "#" 匹配父级时，目标 "/#" 没有任何层级，规则不生效
+func TestTopicRouteStripPrefix(t *testing.T) {
+	route, err := ParseTopicRoute("strip", map[string]interface{}{"from": "/vendor/#", "to": "/#"})
+	assert.NoError(t, err)
+	routes := TopicRouteSlice{route}
+	topic, matched := routes.route("/vendor/door/1", nil)
+	assert.Equal(t, "/door/1", topic)
+	assert.Equal(t, route, matched)
+	topic, matched = routes.route("/vendor", nil)
+	assert.Equal(t, "/vendor", topic)
+	assert.Nil(t, matched)
+}
+
+func TestParseTopicRouteInvalid(t *testing.T) {
+	for _, c := range []map[string]interface{}{
+		{"from": "vendor/+", "to": "/a/+"},
+		{"from": "/vendor/+", "to": "a/+"},
+		{"from": "/vendor/+", "to": "/a/+/+"},
+		{"from": "/vendor/+", "to": "/a/#"},
+		{"from": "/vendor/#", "to": "/a/#/b"},
+		{"from": "/vendor/{door}", "to": "/a/{site}"},
+		{"from": "/vendor/+", "to": "/a//+"},
+		{"from": "/vendor/+", "to": "/a/b+"},
+		{"from": "/vendor/{door}", "to": "/a/x{door}"},
+		{"from": "/vendor/{door}", "to": "/a/{door"},
+		{"from": "/vendor/{door}", "to": "/a/door}"},
+	} {
+		_, err := ParseTopicRoute("test", c)
+		assert.Error(t, err, "%v", c)
+	}
+}
@@ -0,0 +1,271 @@
+package gecko
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/yoojia/go-gecko/v2/utils"
+	"github.com/yoojia/go-value"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+//
+// Author: 陈哈哈 chenyongjia@parkingwang.com, yoojiachen@gmail.com
+//
+
+// Schema 是JSON-Schema的子集，用于在Decode之后校验消息数据，避免Driver防御性地检查每个字段。
+// 支持的关键字：type, required, properties, additionalProperties, items, enum,
+// minimum, maximum, minLength, maxLength, pattern, minItems, maxItems。
+// 支持的type：object, array, string, number, integer, boolean, null。
+type Schema struct {
+	Type                 string
+	Required             []string
+	Properties           map[string]*Schema
+	AdditionalProperties bool
+	Items                *Schema
+	Enum                 []interface{}
+	Minimum              *float64
+	Maximum              *float64
+	MinLength            *int
+	MaxLength            *int
+	MinItems             *int
+	MaxItems             *int
+	Pattern              *regexp.Regexp
+}
+
+// 校验失败的条目
+type SchemaViolation struct {
+	Path    string
+	Message string
+}
+
+func (v SchemaViolation) String() string {
+	return v.Path + ": " + v.Message
+}
+
+// 从配置Map中解析Schema
+func ParseSchema(config map[string]interface{}) (*Schema, error) {
+	s := &Schema{
+		Type:                 value.Of(config["type"]).String(),
+		AdditionalProperties: true,
+	}
+	switch s.Type {
+	case "", "object", "array", "string", "number", "integer", "boolean", "null":
+	default:
+		return nil, errors.Errorf("schema: unsupported type: %s", s.Type)
+	}
+	if v, ok := config["required"]; ok {
+		s.Required = utils.ToStringArray(v)
+	}
+	if v, ok := config["additionalProperties"]; ok {
+		s.AdditionalProperties = value.Of(v).MustBool()
+	}
+	if v, ok := config["properties"]; ok {
+		s.Properties = make(map[string]*Schema)
+		for name, prop := range utils.ToMap(v) {
+			child, err := ParseSchema(utils.ToMap(prop))
+			if nil != err {
+				return nil, errors.WithMessage(err, "property: "+name)
+			}
+			s.Properties[name] = child
+		}
+	}
+	if v, ok := config["items"]; ok {
+		items, err := ParseSchema(utils.ToMap(v))
+		if nil != err {
+			return nil, errors.WithMessage(err, "items")
+		}
+		s.Items = items
+	}
+	if v, ok := config["enum"]; ok {
+		enum, ok := v.([]interface{})
+		if !ok {
+			return nil, errors.New("schema: enum must be an array")
+		}
+		s.Enum = enum
+	}
+	for key, ptr := range map[string]**float64{"minimum": &s.Minimum, "maximum": &s.Maximum} {
+		if v, ok := config[key]; ok {
+			f, ok := toFloat64(v)
+			if !ok {
+				return nil, errors.Errorf("schema: %s must be a number", key)
+			}
+			*ptr = &f
+		}
+	}
+	for key, ptr := range map[string]**int{"minLength": &s.MinLength, "maxLength": &s.MaxLength,
+		"minItems": &s.MinItems, "maxItems": &s.MaxItems} {
+		if v, ok := config[key]; ok {
+			i, ok := value.ToInt64(v)
+			if !ok {
+				return nil, errors.Errorf("schema: %s must be an integer", key)
+			}
+			n := int(i)
+			*ptr = &n
+		}
+	}
+	if v, ok := config["pattern"]; ok {
+		re, err := regexp.Compile(value.ToString(v))
+		if nil != err {
+			return nil, errors.Wrap(err, "schema: invalid pattern")
+		}
+		s.Pattern = re
+	}
+	return s, nil
+}
+
+// 校验消息的Fields数据，返回全部校验失败条目；校验通过时返回空列表。
+func (s *Schema) Validate(fields map[string]interface{}) []SchemaViolation {
+	out := make([]SchemaViolation, 0)
+	s.validate("", fields, &out)
+	return out
+}
+
+func (s *Schema) validate(path string, val interface{}, out *[]SchemaViolation) {
+	report := func(format string, args ...interface{}) {
+		p := path
+		if "" == p {
+			p = "/"
+		}
+		*out = append(*out, SchemaViolation{Path: p, Message: fmt.Sprintf(format, args...)})
+	}
+	if "" != s.Type && !schemaTypeMatches(s.Type, val) {
+		report("expected type %s, got %s", s.Type, schemaTypeOf(val))
+		return
+	}
+	if len(s.Enum) > 0 {
+		found := false
+		for _, e := range s.Enum {
+			if schemaValueEquals(e, val) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			report("value %v not in enum %v", val, s.Enum)
+		}
+	}
+	if str, ok := val.(string); ok {
+		length := len([]rune(str))
+		if nil != s.MinLength && length < *s.MinLength {
+			report("length %d less than minLength %d", length, *s.MinLength)
+		}
+		if nil != s.MaxLength && length > *s.MaxLength {
+			report("length %d greater than maxLength %d", length, *s.MaxLength)
+		}
+		if nil != s.Pattern && !s.Pattern.MatchString(str) {
+			report("value %q not match pattern %s", str, s.Pattern.String())
+		}
+	} else if num, ok := schemaNumber(val); ok {
+		if nil != s.Minimum && num < *s.Minimum {
+			report("value %v less than minimum %v", num, *s.Minimum)
+		}
+		if nil != s.Maximum && num > *s.Maximum {
+			report("value %v greater than maximum %v", num, *s.Maximum)
+		}
+	}
+	if obj, ok := toMap(val); ok {
+		for _, name := range s.Required {
+			if _, ok := obj[name]; !ok {
+				*out = append(*out, SchemaViolation{Path: path + "/" + name, Message: "required field is missing"})
+			}
+		}
+		names := make([]string, 0, len(obj))
+		for name := range obj {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if prop, ok := s.Properties[name]; ok {
+				prop.validate(path+"/"+name, obj[name], out)
+			} else if !s.AdditionalProperties {
+				*out = append(*out, SchemaViolation{Path: path + "/" + name, Message: "additional field is not allowed"})
+			}
+		}
+	} else if items, ok := toSlice(val); ok {
+		if nil != s.MinItems && len(items) < *s.MinItems {
+			report("items count %d less than minItems %d", len(items), *s.MinItems)
+		}
+		if nil != s.MaxItems && len(items) > *s.MaxItems {
+			report("items count %d greater than maxItems %d", len(items), *s.MaxItems)
+		}
+		if nil != s.Items {
+			for i, item := range items {
+				s.Items.validate(fmt.Sprintf("%s/%d", path, i), item, out)
+			}
+		}
+	}
+}
+
+func schemaNumber(val interface{}) (float64, bool) {
+	switch val.(type) {
+	case float32, float64, int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return toFloat64(val)
+	default:
+		return 0, false
+	}
+}
+
+func schemaTypeOf(val interface{}) string {
+	if nil == val {
+		return "null"
+	}
+	switch val.(type) {
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	}
+	if num, ok := schemaNumber(val); ok {
+		if num == float64(int64(num)) {
+			return "integer"
+		}
+		return "number"
+	}
+	if _, ok := toMap(val); ok {
+		return "object"
+	}
+	if _, ok := toSlice(val); ok {
+		return "array"
+	}
+	return strings.ToLower(reflect.TypeOf(val).Kind().String())
+}
+
+func schemaTypeMatches(expected string, val interface{}) bool {
+	actual := schemaTypeOf(val)
+	return expected == actual || ("number" == expected && "integer" == actual)
+}
+
+func schemaValueEquals(expected, actual interface{}) bool {
+	if en, ok := schemaNumber(expected); ok {
+		an, ok := schemaNumber(actual)
+		return ok && en == an
+	}
+	return reflect.DeepEqual(expected, actual)
+}
+
+////
+
+// 按Topic匹配的Schema
+type topicSchema struct {
+	name   string
+	topics []*TopicExpr
+	schema *Schema
+}
+
+// 创建Schema校验失败的响应消息
+func newSchemaInvalidPacket(violations []SchemaViolation) *MessagePacket {
+	items := make([]interface{}, len(violations))
+	for i, v := range violations {
+		items[i] = map[string]interface{}{
+			"path":    v.Path,
+			"message": v.Message,
+		}
+	}
+	return NewMessagePacketFields(map[string]interface{}{
+		"error":      "SCHEMA_INVALID",
+		"violations": items,
+	})
+}
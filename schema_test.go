@@ -0,0 +1,89 @@
+package gecko
+
+import (
+	"encoding/json"
+	"github.com/BurntSushi/toml"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+const testSchemaToml = `
+[SCHEMAS.CardSwipe]
+  topics = ["/access/+/swipe"]
+[SCHEMAS.CardSwipe.schema]
+  type = "object"
+  required = ["card", "door"]
+[SCHEMAS.CardSwipe.schema.properties.card]
+  type = "string"
+  pattern = "^[0-9]+$"
+  maxLength = 8
+[SCHEMAS.CardSwipe.schema.properties.door]
+  type = "integer"
+  minimum = 1
+  maximum = 4
+[SCHEMAS.CardSwipe.schema.properties.event]
+  enum = ["swipe", "open"]
+[SCHEMAS.CardSwipe.schema.properties.tags]
+  type = "array"
+  maxItems = 2
+  items = { type = "string" }
+`
+
+func loadTestSchema(t *testing.T) *Schema {
+	config := make(map[string]interface{})
+	_, err := toml.Decode(testSchemaToml, &config)
+	assert.NoError(t, err)
+	item := config["SCHEMAS"].(map[string]interface{})["CardSwipe"].(map[string]interface{})
+	schema, err := ParseSchema(item["schema"].(map[string]interface{}))
+	assert.NoError(t, err)
+	return schema
+}
+
+func TestSchemaValidate(t *testing.T) {
+	schema := loadTestSchema(t)
+	valid := map[string]interface{}{}
+	assert.NoError(t, json.Unmarshal([]byte(`{"card":"1234","door":2,"event":"swipe","tags":["a"]}`), &valid))
+	assert.Empty(t, schema.Validate(valid))
+
+	invalid := map[string]interface{}{}
+	assert.NoError(t, json.Unmarshal([]byte(`{"card":"12AB34567","door":2.5,"event":"x","tags":["a",1,"c"]}`), &invalid))
+	violations := schema.Validate(invalid)
+	paths := make([]string, 0)
+	for _, v := range violations {
+		paths = append(paths, v.Path)
+	}
+	assert.Equal(t, []string{"/card", "/card", "/door", "/event", "/tags", "/tags/1"}, paths)
+
+	missing := schema.Validate(map[string]interface{}{"card": "1"})
+	assert.Equal(t, 1, len(missing))
+	assert.Equal(t, "/door", missing[0].Path)
+}
+
+func TestSchemaParseErrors(t *testing.T) {
+	_, err := ParseSchema(map[string]interface{}{"type": "date"})
+	assert.Error(t, err)
+	_, err = ParseSchema(map[string]interface{}{"pattern": "(a"})
+	assert.Error(t, err)
+	_, err = ParseSchema(map[string]interface{}{"properties": map[string]interface{}{
+		"a": map[string]interface{}{"minimum": "x"},
+	}})
+	assert.Error(t, err)
+}
+
+func TestInputDelivererRejectsInvalidSchema(t *testing.T) {
+	p := newTestPipeline()
+	p.AddTopicSchema("CardSwipe", []string{"/access/+/swipe"}, loadTestSchema(t))
+	input := NewAbcInputDevice()
+	input.setUuid("input-uuid")
+	input.setDecoder(JSONDefaultDecoder)
+	input.setEncoder(JSONDefaultEncoder)
+
+	ret, err := p.newInputDeliverer(input).Deliver("/access/1/swipe", FramePacket(`{"card":"x"}`))
+	assert.NoError(t, err)
+	resp := make(map[string]interface{})
+	assert.NoError(t, json.Unmarshal(ret, &resp))
+	assert.Equal(t, "SCHEMA_INVALID", resp["error"])
+	assert.Equal(t, 2, len(resp["violations"].([]interface{})))
+	// 校验失败的消息不进入Interceptor调度
+	assert.Equal(t, 0, len(p.interceptorChan))
+}
@@ -74,6 +74,10 @@ func (d *UARTInputDevice) Serve(ctx gecko.Context, deliverer gecko.InputDelivere
 			if nil != err {
 				return err
 			}
+			// 单向模式的Input设备没有响应数据
+			if 0 == len(output) {
+				continue
+			}
 			if _, err := port.Write(output); nil != err {
 				return err
 			}
@@ -2,6 +2,7 @@ package gecko
 
 import (
 	"github.com/yoojia/go-value"
+	"sync"
 	"time"
 )
 
@@ -32,26 +33,39 @@ type Attributes interface {
 	HasAttr(key string) bool
 }
 
+// AttrMap 内部使用读写锁保护，Session属性可以被Driver和多个Trigger并发读写。
 type AttrMap struct {
 	Attributes
+	mu   sync.RWMutex
 	data map[string]interface{}
 }
 
+// 返回属性列表的快照
 func (a *AttrMap) Map() map[string]interface{} {
-	return a.data
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	out := make(map[string]interface{}, len(a.data))
+	for k, v := range a.data {
+		out[k] = v
+	}
+	return out
 }
 
 func (a *AttrMap) Add(key string, value interface{}) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
 	a.data[key] = value
 }
 
 func (a *AttrMap) Get(key string) (interface{}, bool) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
 	v, ok := a.data[key]
 	return v, ok
 }
 
 func (a *AttrMap) GetOrNil(key string) interface{} {
-	if v, ok := a.data[key]; ok {
+	if v, ok := a.Get(key); ok {
 		return v
 	} else {
 		return nil
@@ -59,7 +73,7 @@ func (a *AttrMap) GetOrNil(key string) interface{} {
 }
 
 func (a *AttrMap) GetString(key string) (string, bool) {
-	if val, ok := a.data[key]; ok {
+	if val, ok := a.Get(key); ok {
 		return value.Of(val).String(), true
 	} else {
 		return "", false
@@ -67,7 +81,7 @@ func (a *AttrMap) GetString(key string) (string, bool) {
 }
 
 func (a *AttrMap) GetInt64(key string) (int64, bool) {
-	if val, ok := a.data[key]; ok {
+	if val, ok := a.Get(key); ok {
 		return value.Of(val).ToInt64()
 	} else {
 		return 0, false
@@ -75,10 +89,15 @@ func (a *AttrMap) GetInt64(key string) (int64, bool) {
 }
 
 func (a *AttrMap) HasAttr(key string) bool {
-	_, ok := a.data[key]
+	_, ok := a.Get(key)
 	return ok
 }
 
+// 使用指定属性创建Attributes，通常用于测试组件
+func NewAttributesWith(attrs map[string]interface{}) Attributes {
+	return newMapAttributesWith(attrs)
+}
+
 func newMapAttributesWith(attrs map[string]interface{}) *AttrMap {
 	am := &AttrMap{data: make(map[string]interface{})}
 	for k, v := range attrs {
@@ -94,9 +113,11 @@ type session struct {
 	timestamp time.Time
 	attrs     *AttrMap
 	topic     string
+	tokens    topicTokens
 	uuid      string
 	inbound   *MessagePacket
 	outbound  chan *MessagePacket
+	oneway    bool // 单向事件，不执行Driver
 }
 
 func (s *session) Attrs() Attributes {
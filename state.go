@@ -0,0 +1,372 @@
+package gecko
+
+import (
+	"encoding/json"
+	"github.com/pkg/errors"
+	"github.com/yoojia/go-value"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+//
+// Author: 陈哈哈 chenyongjia@parkingwang.com, yoojiachen@gmail.com
+//
+
+// StateStore 是Driver、Trigger和脚本共享的KeyValue状态存储，用于保存跨事件的状态数据，
+// 例如：防潜回记录、每个门最后刷卡的卡号等。所有函数都是协程安全的。
+// 数据值必须可以被JSON序列化；ttl为0时数据不过期。
+type StateStore interface {
+	// 读取数据；数据不存在或者已过期时返回false
+	Get(key string) (interface{}, bool)
+
+	// 写入数据
+	Set(key string, value interface{}, ttl time.Duration) error
+
+	// 删除数据
+	Delete(key string) error
+
+	// 当前数据等于expected时写入新数据，返回是否写入成功。expected为nil表示数据不存在。
+	CompareAndSet(key string, expected interface{}, value interface{}, ttl time.Duration) (bool, error)
+
+	// 对整数数据增加delta，返回增加后的数值。数据不存在时从0开始计算，并使用ttl作为过期时间；
+	// 数据已存在时保留原有的过期时间。
+	Increment(key string, delta int64, ttl time.Duration) (int64, error)
+
+	// 返回指定前缀的全部Key，按字母排序
+	Keys(prefix string) []string
+
+	// 关闭存储
+	Close() error
+}
+
+// 状态数据条目
+type stateEntry struct {
+	Value    interface{} `json:"value"`
+	ExpireAt int64       `json:"expireAt,omitempty"` // UnixNano；为0时不过期
+}
+
+func (e stateEntry) expired(now time.Time) bool {
+	return 0 != e.ExpireAt && now.UnixNano() >= e.ExpireAt
+}
+
+func newStateEntry(value interface{}, ttl time.Duration) stateEntry {
+	entry := stateEntry{Value: deepCopyValue(value)}
+	if ttl > 0 {
+		entry.ExpireAt = time.Now().Add(ttl).UnixNano()
+	}
+	return entry
+}
+
+////
+
+// 每写入多少次数据，清理一次过期数据
+const statePurgeWrites = 1024
+
+// 内存状态存储
+type MemoryStateStore struct {
+	mu      sync.Mutex
+	entries map[string]stateEntry
+	writes  int
+	// 数据变更后的回调函数，在持有锁的状态下调用
+	onChanged func()
+}
+
+func NewMemoryStateStore() *MemoryStateStore {
+	return &MemoryStateStore{
+		entries: make(map[string]stateEntry),
+	}
+}
+
+// 读取未过期的条目；过期条目被删除。调用方必须持有锁。
+func (s *MemoryStateStore) lookup(key string) (stateEntry, bool) {
+	entry, ok := s.entries[key]
+	if ok && entry.expired(time.Now()) {
+		delete(s.entries, key)
+		return stateEntry{}, false
+	}
+	return entry, ok
+}
+
+// 写入条目，调用方必须持有锁
+func (s *MemoryStateStore) store(key string, entry stateEntry) {
+	s.entries[key] = entry
+	s.writes++
+	if s.writes >= statePurgeWrites {
+		s.writes = 0
+		s.purge(time.Now())
+	}
+	s.changed()
+}
+
+func (s *MemoryStateStore) changed() {
+	if nil != s.onChanged {
+		s.onChanged()
+	}
+}
+
+func (s *MemoryStateStore) purge(now time.Time) {
+	for key, entry := range s.entries {
+		if entry.expired(now) {
+			delete(s.entries, key)
+		}
+	}
+}
+
+func (s *MemoryStateStore) Get(key string) (interface{}, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry, ok := s.lookup(key)
+	if !ok {
+		return nil, false
+	}
+	return deepCopyValue(entry.Value), true
+}
+
+func (s *MemoryStateStore) Set(key string, value interface{}, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.store(key, newStateEntry(value, ttl))
+	return nil
+}
+
+func (s *MemoryStateStore) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.entries[key]; ok {
+		delete(s.entries, key)
+		s.changed()
+	}
+	return nil
+}
+
+func (s *MemoryStateStore) CompareAndSet(key string, expected interface{}, value interface{}, ttl time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry, ok := s.lookup(key)
+	if nil == expected {
+		if ok {
+			return false, nil
+		}
+	} else if !ok || !schemaValueEquals(expected, entry.Value) {
+		return false, nil
+	}
+	s.store(key, newStateEntry(value, ttl))
+	return true, nil
+}
+
+func (s *MemoryStateStore) Increment(key string, delta int64, ttl time.Duration) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry, ok := s.lookup(key)
+	if !ok {
+		entry = newStateEntry(int64(0), ttl)
+	}
+	current, isNum := schemaNumber(entry.Value)
+	if !isNum || current != float64(int64(current)) {
+		return 0, errors.Errorf("state value is not an integer, key: %s", key)
+	}
+	next := int64(current) + delta
+	entry.Value = next
+	s.store(key, entry)
+	return next, nil
+}
+
+func (s *MemoryStateStore) Keys(prefix string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.purge(time.Now())
+	out := make([]string, 0)
+	for key := range s.entries {
+		if strings.HasPrefix(key, prefix) {
+			out = append(out, key)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+func (s *MemoryStateStore) Close() error {
+	return nil
+}
+
+////
+
+// 文件持久化状态存储。数据保存在内存中，变更后以JSON格式写入文件；服务重启后从文件恢复数据。
+// flushInterval为0时，每次变更都同步写入文件；否则按间隔批量写入，关闭时写入最后的变更。
+type FileStateStore struct {
+	*MemoryStateStore
+	path     string
+	dirty    chan struct{}
+	stop     chan struct{}
+	done     chan struct{}
+	flushErr error
+}
+
+func NewFileStateStore(path string, flushInterval time.Duration) (*FileStateStore, error) {
+	fs := &FileStateStore{
+		MemoryStateStore: NewMemoryStateStore(),
+		path:             path,
+	}
+	if err := fs.load(); nil != err {
+		return nil, err
+	}
+	if flushInterval <= 0 {
+		fs.onChanged = func() {
+			fs.flushErr = fs.writeFile(fs.entries)
+		}
+	} else {
+		fs.dirty = make(chan struct{}, 1)
+		fs.stop = make(chan struct{})
+		fs.done = make(chan struct{})
+		fs.onChanged = func() {
+			select {
+			case fs.dirty <- struct{}{}:
+			default:
+			}
+		}
+		go fs.flushLoop(flushInterval)
+	}
+	return fs, nil
+}
+
+func (fs *FileStateStore) load() error {
+	data, err := ioutil.ReadFile(fs.path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if nil != err {
+		return errors.Wrap(err, "读取状态存储文件出错: "+fs.path)
+	}
+	entries := make(map[string]stateEntry)
+	if err := json.Unmarshal(data, &entries); nil != err {
+		return errors.Wrap(err, "解析状态存储文件出错: "+fs.path)
+	}
+	now := time.Now()
+	for key, entry := range entries {
+		if !entry.expired(now) {
+			fs.entries[key] = entry
+		}
+	}
+	return nil
+}
+
+// 先写入临时文件再替换，避免写入过程中断导致数据文件损坏
+func (fs *FileStateStore) writeFile(entries map[string]stateEntry) error {
+	data, err := json.Marshal(entries)
+	if nil != err {
+		return errors.Wrap(err, "序列化状态数据出错")
+	}
+	tmp := fs.path + ".tmp"
+	if err := os.MkdirAll(filepath.Dir(fs.path), 0755); nil != err {
+		return errors.Wrap(err, "创建状态存储目录出错")
+	}
+	if err := ioutil.WriteFile(tmp, data, 0644); nil != err {
+		return errors.Wrap(err, "写入状态存储文件出错: "+tmp)
+	}
+	return errors.Wrap(os.Rename(tmp, fs.path), "替换状态存储文件出错: "+fs.path)
+}
+
+func (fs *FileStateStore) flush() error {
+	fs.mu.Lock()
+	snapshot := make(map[string]stateEntry, len(fs.entries))
+	for key, entry := range fs.entries {
+		snapshot[key] = entry
+	}
+	fs.mu.Unlock()
+	return fs.writeFile(snapshot)
+}
+
+func (fs *FileStateStore) flushLoop(interval time.Duration) {
+	defer close(fs.done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-fs.stop:
+			return
+		case <-ticker.C:
+			select {
+			case <-fs.dirty:
+				if err := fs.flush(); nil != err {
+					log.Errorw("状态存储写入文件失败", "path", fs.path, "error", err)
+				}
+			default:
+			}
+		}
+	}
+}
+
+// 同步写入模式下，返回最近一次写入文件的错误
+func (fs *FileStateStore) Set(key string, value interface{}, ttl time.Duration) error {
+	if err := fs.MemoryStateStore.Set(key, value, ttl); nil != err {
+		return err
+	}
+	return fs.lastFlushErr()
+}
+
+func (fs *FileStateStore) Delete(key string) error {
+	if err := fs.MemoryStateStore.Delete(key); nil != err {
+		return err
+	}
+	return fs.lastFlushErr()
+}
+
+func (fs *FileStateStore) CompareAndSet(key string, expected interface{}, value interface{}, ttl time.Duration) (bool, error) {
+	ok, err := fs.MemoryStateStore.CompareAndSet(key, expected, value, ttl)
+	if nil != err || !ok {
+		return ok, err
+	}
+	return true, fs.lastFlushErr()
+}
+
+func (fs *FileStateStore) Increment(key string, delta int64, ttl time.Duration) (int64, error) {
+	next, err := fs.MemoryStateStore.Increment(key, delta, ttl)
+	if nil != err {
+		return next, err
+	}
+	return next, fs.lastFlushErr()
+}
+
+func (fs *FileStateStore) lastFlushErr() error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	return fs.flushErr
+}
+
+func (fs *FileStateStore) Close() error {
+	if nil != fs.stop {
+		close(fs.stop)
+		<-fs.done
+	}
+	return fs.flush()
+}
+
+////
+
+// 根据[GECKO]配置创建状态存储：
+//
+//	stateStore = "memory"（默认）或者 "file"；
+//	stateStoreFile 文件存储的路径，默认为 "./data/state.json"；
+//	stateStoreFlushInterval 文件写入间隔，默认为1秒，为0时每次变更同步写入；
+func newStateStore(config map[string]interface{}) (StateStore, error) {
+	switch kind := value.Of(config["stateStore"]).String(); kind {
+	case "", "memory":
+		return NewMemoryStateStore(), nil
+	case "file":
+		path := value.Of(config["stateStoreFile"]).String()
+		if "" == path {
+			path = "./data/state.json"
+		}
+		interval := time.Second
+		if v, ok := config["stateStoreFlushInterval"]; ok {
+			interval = value.Of(v).DurationOfDefault(0)
+		}
+		return NewFileStateStore(path, interval)
+	default:
+		return nil, errors.Errorf("unsupported stateStore: %s", kind)
+	}
+}
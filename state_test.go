@@ -0,0 +1,113 @@
+package gecko
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func testStateStore(t *testing.T, store StateStore) {
+	_, ok := store.Get("door:1")
+	assert.False(t, ok)
+
+	assert.NoError(t, store.Set("door:1", map[string]interface{}{"card": "12345"}, 0))
+	v, ok := store.Get("door:1")
+	assert.True(t, ok)
+	assert.Equal(t, map[string]interface{}{"card": "12345"}, v)
+
+	// CAS: nil表示数据不存在
+	swapped, err := store.CompareAndSet("door:2", nil, "A", 0)
+	assert.NoError(t, err)
+	assert.True(t, swapped)
+	swapped, err = store.CompareAndSet("door:2", nil, "B", 0)
+	assert.NoError(t, err)
+	assert.False(t, swapped)
+	swapped, err = store.CompareAndSet("door:2", "A", "B", 0)
+	assert.NoError(t, err)
+	assert.True(t, swapped)
+	v, _ = store.Get("door:2")
+	assert.Equal(t, "B", v)
+
+	n, err := store.Increment("count", 2, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), n)
+	n, err = store.Increment("count", -1, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+	_, err = store.Increment("door:2", 1, 0)
+	assert.Error(t, err)
+
+	assert.Equal(t, []string{"door:1", "door:2"}, store.Keys("door:"))
+	assert.NoError(t, store.Delete("door:1"))
+	assert.Equal(t, []string{"door:2"}, store.Keys("door:"))
+
+	// TTL
+	assert.NoError(t, store.Set("temp", true, 20*time.Millisecond))
+	_, ok = store.Get("temp")
+	assert.True(t, ok)
+	time.Sleep(30 * time.Millisecond)
+	_, ok = store.Get("temp")
+	assert.False(t, ok)
+}
+
+func TestMemoryStateStore(t *testing.T) {
+	testStateStore(t, NewMemoryStateStore())
+}
+
+func TestMemoryStateStoreConcurrentIncrement(t *testing.T) {
+	store := NewMemoryStateStore()
+	wg := new(sync.WaitGroup)
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := store.Increment("hits", 1, 0)
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+	v, _ := store.Get("hits")
+	assert.Equal(t, int64(50), v)
+}
+
+func TestFileStateStorePersist(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gecko-state")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "data", "state.json")
+
+	for _, interval := range []time.Duration{0, 10 * time.Millisecond} {
+		os.Remove(path)
+		store, err := NewFileStateStore(path, interval)
+		assert.NoError(t, err)
+		testStateStore(t, store)
+		assert.NoError(t, store.Set("expired", 1, time.Millisecond))
+		assert.NoError(t, store.Close())
+
+		time.Sleep(5 * time.Millisecond)
+		reopened, err := NewFileStateStore(path, interval)
+		assert.NoError(t, err)
+		v, ok := reopened.Get("door:2")
+		assert.True(t, ok)
+		assert.Equal(t, "B", v)
+		n, err := reopened.Increment("count", 1, 0)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(2), n)
+		_, ok = reopened.Get("expired")
+		assert.False(t, ok)
+		assert.NoError(t, reopened.Close())
+	}
+}
+
+func TestNewStateStore(t *testing.T) {
+	store, err := newStateStore(map[string]interface{}{})
+	assert.NoError(t, err)
+	assert.IsType(t, &MemoryStateStore{}, store)
+
+	_, err = newStateStore(map[string]interface{}{"stateStore": "redis"})
+	assert.Error(t, err)
+}
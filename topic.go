@@ -1,6 +1,9 @@
 package gecko
 
-import "strings"
+import (
+	"github.com/pkg/errors"
+	"strings"
+)
 
 //
 // Author: 陈哈哈 chenyongjia@parkingwang.com, yoojiachen@gmail.com
@@ -16,29 +19,218 @@ type NeedTopicFilter interface {
 
 ////
 
-// Topic表达式，类似MQTT的Topic匹配方式
+// 组件读取Topic命名通配符捕获值的属性Key，值类型为 map[string]string。
+// 捕获值只来自选中当前组件的Topic表达式，不同组件读取各自的捕获值。
+const TopicVarsAttrKey = "@Topic.VARS"
+
+// Topic表达式，类似MQTT的Topic匹配方式：
+// 1. 表达式必须以"/"开头，且每一层级不能为空；
+// 2. "+" 匹配单个层级，必须独占一个层级；
+// 3. "{name}" 为命名的单层级通配符，匹配方式与 "+" 相同，匹配的层级值以name提供给选中的组件；
+// 4. "#" 匹配父级及其任意子级，必须独占一个层级且只能是最后一层；
+// 5. 第一层级的通配符不匹配以"$"开头的系统Topic。
 type TopicExpr struct {
-	exprs []string
+	expr   string
+	levels []string
+	names  []string // 命名通配符的名称，与levels一一对应；未命名的层级为空字符串
+	multi  bool     // 以 # 结尾
+	static bool     // 不包含任何通配符，直接比较字符串
+}
+
+// 解析并校验Topic表达式
+func ParseTopicExpr(expr string) (*TopicExpr, error) {
+	if "" == expr {
+		return nil, errors.New("Topic表达式为空")
+	}
+	if '/' != expr[0] {
+		return nil, errors.Errorf("Topic表达式必须以'/'开头: %s", expr)
+	}
+	levels := strings.Split(expr, "/")[1:]
+	te := &TopicExpr{expr: expr, levels: levels, static: true}
+	for i, level := range levels {
+		switch {
+		case "" == level:
+			return nil, errors.Errorf("Topic表达式包含空层级: %s", expr)
+		case "#" == level:
+			if i != len(levels)-1 {
+				return nil, errors.Errorf("Topic表达式中'#'只能是最后一个层级: %s", expr)
+			}
+			te.multi = true
+			te.static = false
+		case "+" == level:
+			te.static = false
+		case strings.ContainsAny(level, "+#"):
+			return nil, errors.Errorf("Topic表达式中通配符必须独占一个层级: %s", expr)
+		case strings.ContainsAny(level, "{}"):
+			name, err := topicVarName(level, te.names)
+			if nil != err {
+				return nil, errors.WithMessage(err, expr)
+			}
+			if nil == te.names {
+				te.names = make([]string, len(levels))
+			}
+			te.names[i] = name
+			levels[i] = "+"
+			te.static = false
+		}
+	}
+	return te, nil
+}
+
+// 解析命名通配符 {name} 的名称
+func topicVarName(level string, names []string) (string, error) {
+	if len(level) < 3 || '{' != level[0] || '}' != level[len(level)-1] {
+		return "", errors.Errorf("命名通配符必须为{name}格式且独占一个层级: %s", level)
+	}
+	name := level[1 : len(level)-1]
+	for i, c := range name {
+		if !('_' == c || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || (i > 0 && '0' <= c && c <= '9')) {
+			return "", errors.Errorf("命名通配符名称只能包含字母、数字和下划线: %s", level)
+		}
+	}
+	for _, n := range names {
+		if n == name {
+			return "", errors.Errorf("命名通配符名称重复: %s", level)
+		}
+	}
+	return name, nil
+}
+
+// 返回Topic表达式的原始字符串
+func (t *TopicExpr) String() string {
+	return t.expr
 }
 
 // 判断当前Topic与外部Topic是否匹配
 func (t *TopicExpr) matches(topic string) bool {
-	ss := strings.Split(topic, "/")[1:]
-	if len(t.exprs) > len(ss) {
+	return t.matchTokens(tokenizeTopic(topic))
+}
+
+// 使用已切分的Topic进行匹配
+func (t *TopicExpr) matchTokens(topic topicTokens) bool {
+	if t.static {
+		return t.expr == topic.raw
+	}
+	levels := topic.levels
+	if 0 == len(levels) {
 		return false
 	}
-	for i, ex := range t.exprs {
-		if "#" == ex {
-			return true
-		} else if ex != "+" && ex != ss[i] {
+	size := len(t.levels)
+	if t.multi {
+		// # 同时匹配父级
+		size--
+		if len(levels) < size {
+			return false
+		}
+	} else if len(levels) != size {
+		return false
+	}
+	if strings.HasPrefix(levels[0], "$") && (0 == size || "+" == t.levels[0]) {
+		return false
+	}
+	for i := 0; i < size; i++ {
+		if ex := t.levels[i]; "+" != ex && ex != levels[i] {
 			return false
 		}
 	}
 	return true
 }
 
+// 判断是否包含命名通配符
+func (t *TopicExpr) hasNames() bool {
+	return nil != t.names
+}
+
+// 返回Topic中命名通配符对应层级的值，表达式没有命名通配符时返回nil。
+// 调用前需确认Topic与表达式匹配。
+func (t *TopicExpr) capture(topic topicTokens) map[string]string {
+	if !t.hasNames() {
+		return nil
+	}
+	vars := make(map[string]string)
+	for i, name := range t.names {
+		if "" != name && i < len(topic.levels) {
+			vars[name] = topic.levels[i]
+		}
+	}
+	return vars
+}
+
+// 解析Topic表达式，表达式错误时Panic。用于加载配置阶段。
 func newTopicExpr(expr string) *TopicExpr {
-	return &TopicExpr{
-		exprs: strings.Split(expr, "/")[1:],
+	te, err := ParseTopicExpr(expr)
+	if nil != err {
+		log.Panicw("Topic表达式错误", "topic", expr, "error", err)
+	}
+	return te
+}
+
+////
+
+// 已切分层级的Topic。每个Session只切分一次，与多个TopicExpr匹配时复用。
+type topicTokens struct {
+	raw    string
+	levels []string
+}
+
+// 切分Topic层级。不以"/"开头的Topic无法匹配任何通配表达式。
+func tokenizeTopic(topic string) topicTokens {
+	tt := topicTokens{raw: topic}
+	if "" != topic && '/' == topic[0] {
+		tt.levels = strings.Split(topic, "/")[1:]
+	}
+	return tt
+}
+
+////
+
+// 返回组件属性中Topic命名通配符捕获的全部值
+func GetTopicVars(attrs Attributes) map[string]string {
+	if vars, ok := attrs.GetOrNil(TopicVarsAttrKey).(map[string]string); ok {
+		return vars
+	}
+	return map[string]string{}
+}
+
+// 返回组件属性中Topic命名通配符捕获的值
+func GetTopicVar(attrs Attributes, name string) (string, bool) {
+	v, ok := GetTopicVars(attrs)[name]
+	return v, ok
+}
+
+// 组件视角的Session属性：读取 TopicVarsAttrKey 时返回选中组件的Topic表达式捕获的值，
+// 其它属性的读写与Session共享。
+type topicVarsAttributes struct {
+	Attributes
+	vars map[string]string
+}
+
+// 返回附带Topic命名通配符捕获值的属性视图，没有捕获值时直接返回原属性
+func withTopicVars(attrs Attributes, vars map[string]string) Attributes {
+	if 0 == len(vars) {
+		return attrs
 	}
+	return &topicVarsAttributes{Attributes: attrs, vars: vars}
+}
+
+func (a *topicVarsAttributes) Map() map[string]interface{} {
+	out := a.Attributes.Map()
+	out[TopicVarsAttrKey] = a.vars
+	return out
+}
+
+func (a *topicVarsAttributes) Get(key string) (interface{}, bool) {
+	if TopicVarsAttrKey == key {
+		return a.vars, true
+	}
+	return a.Attributes.Get(key)
+}
+
+func (a *topicVarsAttributes) GetOrNil(key string) interface{} {
+	v, _ := a.Get(key)
+	return v
+}
+
+func (a *topicVarsAttributes) HasAttr(key string) bool {
+	return TopicVarsAttrKey == key || a.Attributes.HasAttr(key)
 }
@@ -7,10 +7,10 @@ import (
 
 func TestTopicExprParse(t *testing.T) {
 	te := newTopicExpr("/device/+/status/#")
-	assert.Equal(t, "device", te.exprs[0])
-	assert.Equal(t, "+", te.exprs[1])
-	assert.Equal(t, "status", te.exprs[2])
-	assert.Equal(t, "#", te.exprs[3])
+	assert.Equal(t, "device", te.levels[0])
+	assert.Equal(t, "+", te.levels[1])
+	assert.Equal(t, "status", te.levels[2])
+	assert.Equal(t, "#", te.levels[3])
 }
 
 func TestTopicExprMatchesDynamic(t *testing.T) {
@@ -42,3 +42,70 @@ func TestTopicExprMatchesStatic(t *testing.T) {
 	assert.False(t, te.matches("/user/1000"))
 	assert.False(t, te.matches("/user"))
 }
+
+func TestParseTopicExprInvalid(t *testing.T) {
+	for _, expr := range []string{"", "device/+", "/", "/device//status", "/device/", "/device/#/status", "/device/a+", "/device/#a"} {
+		_, err := ParseTopicExpr(expr)
+		assert.Error(t, err, expr)
+	}
+	te, err := ParseTopicExpr("/device/+/#")
+	assert.NoError(t, err)
+	assert.Equal(t, "/device/+/#", te.String())
+}
+
+func TestTopicExprMatchesMqttSemantics(t *testing.T) {
+	multi := newTopicExpr("/device/+/status/#")
+	// # 同时匹配父级
+	assert.True(t, multi.matches("/device/11/status"))
+	// 不以"/"开头的Topic不匹配
+	assert.False(t, multi.matches("device/11/status/ok"))
+
+	static := newTopicExpr("/device/0755/status")
+	assert.False(t, static.matches("/device/0755/status/error"))
+	assert.False(t, static.matches("device/0755/status"))
+
+	single := newTopicExpr("/device/+")
+	assert.True(t, single.matches("/device/"))
+	assert.False(t, single.matches("/device/1/2"))
+
+	all := newTopicExpr("/#")
+	assert.True(t, all.matches("/device/1"))
+	assert.False(t, all.matches("/$SYS/info"))
+	assert.False(t, newTopicExpr("/+/info").matches("/$SYS/info"))
+	assert.True(t, newTopicExpr("/$SYS/#").matches("/$SYS/info"))
+}
+
+func TestTopicExprMatchTokensReused(t *testing.T) {
+	tokens := tokenizeTopic("/device/1/status")
+	exprs := []*TopicExpr{newTopicExpr("/user/#"), newTopicExpr("/device/+/status")}
+	assert.True(t, anyTopicMatches(exprs, tokens))
+	assert.False(t, anyTopicMatches(exprs[:1], tokens))
+}
+
+func TestTopicExprNamedWildcards(t *testing.T) {
+	te, err := ParseTopicExpr("/site/{building}/door/{door}/swipe")
+	assert.NoError(t, err)
+	assert.Equal(t, "/site/{building}/door/{door}/swipe", te.String())
+	tokens := tokenizeTopic("/site/B3/door/12/swipe")
+	assert.True(t, te.matchTokens(tokens))
+	assert.False(t, te.matches("/site/B3/door/12"))
+
+	assert.Equal(t, map[string]string{"building": "B3", "door": "12"}, te.capture(tokens))
+	assert.Nil(t, newTopicExpr("/site/+/door").capture(tokenizeTopic("/site/B3/door")))
+
+	for _, expr := range []string{"/site/{}", "/site/{b", "/site/x{b}", "/site/{1b}", "/site/{b-c}", "/{b}/{b}", "/site/{b+}"} {
+		_, err := ParseTopicExpr(expr)
+		assert.Error(t, err, expr)
+	}
+}
+
+func TestGetTopicVars(t *testing.T) {
+	attrs := NewAttributesWith(map[string]interface{}{})
+	assert.Equal(t, map[string]string{}, GetTopicVars(attrs))
+	attrs.Add(TopicVarsAttrKey, map[string]string{"door": "12"})
+	v, ok := GetTopicVar(attrs, "door")
+	assert.True(t, ok)
+	assert.Equal(t, "12", v)
+	_, ok = GetTopicVar(attrs, "building")
+	assert.False(t, ok)
+}
@@ -0,0 +1,174 @@
+package gecko
+
+import (
+	"sort"
+	"strings"
+)
+
+//
+// Author: 陈哈哈 chenyongjia@parkingwang.com, yoojiachen@gmail.com
+//
+
+// Topic前缀树，支持 + 和 # 通配符。
+// 以组件的Topic表达式构建，按Topic层级查找匹配的组件，查找耗时与Topic层级深度相关，与组件数量无关。
+type topicTrie struct {
+	root *topicTrieNode
+	seq  int
+}
+
+type topicTrieNode struct {
+	children map[string]*topicTrieNode
+	plus     *topicTrieNode
+	multi    []topicTrieEntry // 以 # 结尾的表达式，匹配当前层级及其任意子级
+	ends     []topicTrieEntry // 在当前层级结束的表达式
+}
+
+type topicTrieEntry struct {
+	seq   int // 添加顺序，匹配结果按添加顺序返回
+	index int // 表达式在组件Topic列表中的序号
+	expr  *TopicExpr
+	value interface{}
+}
+
+// Topic匹配的组件，以及选中该组件的Topic表达式
+type topicMatch struct {
+	value interface{}
+	expr  *TopicExpr
+}
+
+// 返回组件视角的Session属性，附带选中组件的表达式捕获的命名通配符值
+func (m topicMatch) attrs(session *session) Attributes {
+	if nil == m.expr {
+		return session.Attrs()
+	}
+	return withTopicVars(session.Attrs(), m.expr.capture(session.tokens))
+}
+
+func newTopicTrie() *topicTrie {
+	return &topicTrie{root: new(topicTrieNode)}
+}
+
+// 添加组件及其Topic表达式列表
+func (t *topicTrie) add(exprs []*TopicExpr, value interface{}) {
+	seq := t.seq
+	t.seq++
+	for index, expr := range exprs {
+		entry := topicTrieEntry{seq: seq, index: index, expr: expr, value: value}
+		node := t.root
+		for _, level := range expr.levels {
+			switch level {
+			case "#":
+				node.multi = append(node.multi, entry)
+				node = nil
+			case "+":
+				if nil == node.plus {
+					node.plus = new(topicTrieNode)
+				}
+				node = node.plus
+			default:
+				if nil == node.children {
+					node.children = make(map[string]*topicTrieNode)
+				}
+				next, ok := node.children[level]
+				if !ok {
+					next = new(topicTrieNode)
+					node.children[level] = next
+				}
+				node = next
+			}
+			if nil == node {
+				break
+			}
+		}
+		if nil != node {
+			node.ends = append(node.ends, entry)
+		}
+	}
+}
+
+// 查找与Topic匹配的组件，按添加顺序返回；同一组件多个表达式匹配时只返回一次，
+// 以组件Topic列表中第一个匹配的表达式作为选中组件的表达式。
+func (t *topicTrie) match(topic topicTokens) []topicMatch {
+	if 0 == len(topic.levels) {
+		return nil
+	}
+	entries := make([]topicTrieEntry, 0)
+	// 第一层级的通配符不匹配以"$"开头的系统Topic
+	system := strings.HasPrefix(topic.levels[0], "$")
+	t.root.collect(topic.levels, 0, system, &entries)
+	if 0 == len(entries) {
+		return nil
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].seq != entries[j].seq {
+			return entries[i].seq < entries[j].seq
+		}
+		return entries[i].index < entries[j].index
+	})
+	out := make([]topicMatch, 0, len(entries))
+	for i, e := range entries {
+		if 0 == i || entries[i-1].seq != e.seq {
+			out = append(out, topicMatch{value: e.value, expr: e.expr})
+		}
+	}
+	return out
+}
+
+func (n *topicTrieNode) collect(levels []string, depth int, system bool, out *[]topicTrieEntry) {
+	wildcard := !(system && 0 == depth)
+	if wildcard {
+		*out = append(*out, n.multi...)
+	}
+	if depth == len(levels) {
+		*out = append(*out, n.ends...)
+		return
+	}
+	if next, ok := n.children[levels[depth]]; ok {
+		next.collect(levels, depth+1, system, out)
+	}
+	if wildcard && nil != n.plus {
+		n.plus.collect(levels, depth+1, system, out)
+	}
+}
+
+////
+
+// 按Topic查找Interceptor、OutboundInterceptor、Driver和Trigger组件的路由表
+type topicRouter struct {
+	interceptors *topicTrie
+	outbounds    *topicTrie
+	drivers      *topicTrie
+	triggers     *topicTrie
+}
+
+func newTopicRouter(re *Register) *topicRouter {
+	router := &topicRouter{
+		interceptors: newTopicTrie(),
+		outbounds:    newTopicTrie(),
+		drivers:      newTopicTrie(),
+		triggers:     newTopicTrie(),
+	}
+	for el := re.interceptors.Front(); el != nil; el = el.Next() {
+		router.interceptors.add(el.Value.(Interceptor).GetTopicExpr(), el.Value)
+	}
+	// Driver按优先级从高到低添加；Fallback Driver只在没有Driver匹配时使用，不参与路由
+	drivers := make([]Driver, 0, re.drivers.Len())
+	for el := re.drivers.Front(); el != nil; el = el.Next() {
+		if driver := el.Value.(Driver); driver != re.fallbackDriver {
+			drivers = append(drivers, driver)
+		}
+	}
+	sort.SliceStable(drivers, func(i, j int) bool {
+		return drivers[i].GetPriority() > drivers[j].GetPriority()
+	})
+	for _, driver := range drivers {
+		router.drivers.add(driver.GetTopicExpr(), driver)
+	}
+	for el := re.triggers.Front(); el != nil; el = el.Next() {
+		router.triggers.add(el.Value.(Trigger).GetTopicExpr(), el.Value)
+	}
+	for el := re.outbounds.Front(); el != nil; el = el.Next() {
+		router.outbounds.add(el.Value.(OutboundInterceptor).GetTopicExpr(), el.Value)
+	}
+	return router
+}
@@ -0,0 +1,113 @@
+package gecko
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestTopicTrieMatchesInOrder(t *testing.T) {
+	trie := newTopicTrie()
+	trie.add([]*TopicExpr{newTopicExpr("/door/+/open"), newTopicExpr("/door/#")}, "A")
+	trie.add([]*TopicExpr{newTopicExpr("/door/1/open")}, "B")
+	trie.add([]*TopicExpr{newTopicExpr("/#")}, "C")
+	trie.add([]*TopicExpr{newTopicExpr("/user/+")}, "D")
+
+	assert.Equal(t, []interface{}{"A", "B", "C"}, matchValues(trie, tokenizeTopic("/door/1/open")))
+	assert.Equal(t, []interface{}{"A", "C"}, matchValues(trie, tokenizeTopic("/door")))
+	assert.Equal(t, []interface{}{"C", "D"}, matchValues(trie, tokenizeTopic("/user/1")))
+	assert.Equal(t, []interface{}{"C"}, matchValues(trie, tokenizeTopic("/user/1/2")))
+	assert.Nil(t, matchValues(trie, tokenizeTopic("door/1/open")))
+	assert.Nil(t, matchValues(trie, tokenizeTopic("/$SYS/info")))
+}
+
+func matchValues(trie *topicTrie, topic topicTokens) []interface{} {
+	hits := trie.match(topic)
+	if nil == hits {
+		return nil
+	}
+	out := make([]interface{}, 0, len(hits))
+	for _, hit := range hits {
+		out = append(out, hit.value)
+	}
+	return out
+}
+
+// 同一组件多个表达式匹配时，以Topic列表中第一个匹配的表达式选中组件
+func TestTopicTrieMatchSelectsFirstExpr(t *testing.T) {
+	trie := newTopicTrie()
+	trie.add([]*TopicExpr{newTopicExpr("/door/#"), newTopicExpr("/door/{door}/open")}, "A")
+	trie.add([]*TopicExpr{newTopicExpr("/{site}/+/#"), newTopicExpr("/door/{door}/open")}, "B")
+	hits := trie.match(tokenizeTopic("/door/1/open"))
+	assert.Equal(t, 2, len(hits))
+	assert.Equal(t, "/door/#", hits[0].expr.String())
+	assert.Equal(t, "/{site}/+/#", hits[1].expr.String())
+}
+
+// 前缀树与线性匹配的结果必须一致
+func TestTopicTrieConsistentWithLinearScan(t *testing.T) {
+	exprs := []string{"/#", "/+", "/a", "/a/#", "/a/+", "/a/b", "/+/b", "/+/+/c", "/a/+/#", "/$SYS/#", "/+/b/#"}
+	topics := []string{"/", "/a", "/b", "/a/b", "/a/c", "/x/b", "/a/b/c", "/a/b/c/d", "/$SYS/a", "/a//c", "a/b", ""}
+	trie := newTopicTrie()
+	for _, e := range exprs {
+		trie.add([]*TopicExpr{newTopicExpr(e)}, e)
+	}
+	for _, topic := range topics {
+		expected := make([]interface{}, 0)
+		for _, e := range exprs {
+			if newTopicExpr(e).matches(topic) {
+				expected = append(expected, e)
+			}
+		}
+		actual := matchValues(trie, tokenizeTopic(topic))
+		if 0 == len(expected) {
+			assert.Empty(t, actual, topic)
+		} else {
+			assert.Equal(t, expected, actual, topic)
+		}
+	}
+}
+
+// 模拟大型部署：数百个Trigger，数千个门禁Topic
+func benchmarkTopicExprs() [][]*TopicExpr {
+	exprs := make([][]*TopicExpr, 0)
+	for i := 0; i < 2000; i++ {
+		exprs = append(exprs, []*TopicExpr{newTopicExpr(fmt.Sprintf("/door/%d/swipe", i))})
+	}
+	for i := 0; i < 500; i++ {
+		exprs = append(exprs, []*TopicExpr{newTopicExpr(fmt.Sprintf("/building/%d/+/alarm/#", i))})
+	}
+	exprs = append(exprs, []*TopicExpr{newTopicExpr("/door/+/swipe")})
+	return exprs
+}
+
+func BenchmarkTopicTrieMatch(b *testing.B) {
+	trie := newTopicTrie()
+	for i, e := range benchmarkTopicExprs() {
+		trie.add(e, i)
+	}
+	topic := tokenizeTopic("/door/1024/swipe")
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if 2 != len(trie.match(topic)) {
+			b.Fatal("unexpected matches")
+		}
+	}
+}
+
+func BenchmarkTopicLinearScan(b *testing.B) {
+	exprs := benchmarkTopicExprs()
+	topic := tokenizeTopic("/door/1024/swipe")
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		hits := make([]interface{}, 0)
+		for idx, e := range exprs {
+			if anyTopicMatches(e, topic) {
+				hits = append(hits, idx)
+			}
+		}
+		if 2 != len(hits) {
+			b.Fatal("unexpected matches")
+		}
+	}
+}
@@ -19,6 +19,7 @@ type AbcTrigger struct {
 	Trigger
 	name   string
 	topics []*TopicExpr
+	where  *WhereExpr
 }
 
 func (ad *AbcTrigger) setName(name string) {
@@ -41,6 +42,15 @@ func (ad *AbcTrigger) GetTopicExpr() []*TopicExpr {
 	return ad.topics
 }
 
+func (ad *AbcTrigger) setWhere(where *WhereExpr) {
+	ad.where = where
+}
+
+// 获取消息内容过滤表达式
+func (ad *AbcTrigger) GetWhereExpr() *WhereExpr {
+	return ad.where
+}
+
 func NewAbcTrigger() *AbcTrigger {
 	return &AbcTrigger{
 		topics: make([]*TopicExpr, 0),
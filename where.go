@@ -0,0 +1,436 @@
+package gecko
+
+import (
+	"github.com/pkg/errors"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+//
+// Author: 陈哈哈 chenyongjia@parkingwang.com, yoojiachen@gmail.com
+//
+
+// 需要消息内容过滤支持
+type NeedWhereFilter interface {
+	// 设置消息内容过滤表达式
+	setWhere(where *WhereExpr)
+	// 返回消息内容过滤表达式，未设置时返回nil
+	GetWhereExpr() *WhereExpr
+}
+
+// 返回组件的消息内容过滤表达式，组件不支持或者未设置时返回nil
+func whereOf(component interface{}) *WhereExpr {
+	if wf, ok := component.(NeedWhereFilter); ok {
+		return wf.GetWhereExpr()
+	}
+	return nil
+}
+
+// 消息内容过滤表达式。在Topic匹配之后，按消息字段和Session属性进一步筛选组件，例如：
+//
+//	where = 'event == "swipe" && door > 2 && attrs.user != null'
+//
+// 支持：
+// 1. 比较运算 ==、!=、>、>=、<、<=；逻辑运算 &&、||、!；括号；
+// 2. 字面量：双引号或单引号字符串、数字、true、false、null；
+// 3. 标识符：消息字段路径（如 reader.tags[0]）；attrs.KEY 读取Session属性；vars.NAME 读取选中当前组件的Topic表达式中命名通配符的值。
+// 数字与数字字符串比较时按数值比较；不存在的字段值为null；单独的标识符按非空、非零、非false判断。
+type WhereExpr struct {
+	expr string
+	root whereNode
+}
+
+// 解析消息内容过滤表达式
+func ParseWhereExpr(expr string) (*WhereExpr, error) {
+	tokens, err := lexWhere(expr)
+	if nil != err {
+		return nil, err
+	}
+	p := &whereParser{tokens: tokens}
+	root, err := p.parseOr()
+	if nil != err {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, errors.Errorf("where: unexpected token %q in: %s", p.tokens[p.pos].text, expr)
+	}
+	return &WhereExpr{expr: expr, root: root}, nil
+}
+
+// 返回表达式的原始字符串
+func (w *WhereExpr) String() string {
+	return w.expr
+}
+
+// 判断消息是否满足过滤条件。nil表达式总是满足。
+func (w *WhereExpr) Match(attrs Attributes, msg *MessagePacket) bool {
+	if nil == w {
+		return true
+	}
+	return whereTruthy(w.root.eval(&whereEnv{attrs: attrs, msg: msg}))
+}
+
+////
+
+type whereEnv struct {
+	attrs Attributes
+	msg   *MessagePacket
+}
+
+type whereNode interface {
+	eval(env *whereEnv) interface{}
+}
+
+type whereLiteral struct {
+	value interface{}
+}
+
+func (n *whereLiteral) eval(_ *whereEnv) interface{} {
+	return n.value
+}
+
+type whereField struct {
+	tokens []fieldPathToken
+}
+
+func (n *whereField) eval(env *whereEnv) interface{} {
+	if nil == env.msg {
+		return nil
+	}
+	v, _ := env.msg.lookupFieldTokens(n.tokens)
+	return v
+}
+
+type whereAttr struct {
+	key string
+}
+
+func (n *whereAttr) eval(env *whereEnv) interface{} {
+	if nil == env.attrs {
+		return nil
+	}
+	v, _ := env.attrs.Get(n.key)
+	return v
+}
+
+type whereTopicVar struct {
+	name string
+}
+
+func (n *whereTopicVar) eval(env *whereEnv) interface{} {
+	if nil == env.attrs {
+		return nil
+	}
+	if v, ok := GetTopicVar(env.attrs, n.name); ok {
+		return v
+	}
+	return nil
+}
+
+type whereNot struct {
+	node whereNode
+}
+
+func (n *whereNot) eval(env *whereEnv) interface{} {
+	return !whereTruthy(n.node.eval(env))
+}
+
+type whereLogic struct {
+	and         bool
+	left, right whereNode
+}
+
+func (n *whereLogic) eval(env *whereEnv) interface{} {
+	left := whereTruthy(n.left.eval(env))
+	if n.and != left {
+		// && 左侧为false，或者 || 左侧为true 时直接返回
+		return left
+	}
+	return whereTruthy(n.right.eval(env))
+}
+
+type whereCompare struct {
+	op          string
+	left, right whereNode
+}
+
+func (n *whereCompare) eval(env *whereEnv) interface{} {
+	left, right := n.left.eval(env), n.right.eval(env)
+	switch n.op {
+	case "==":
+		return whereEquals(left, right)
+	case "!=":
+		return !whereEquals(left, right)
+	}
+	cmp, ok := whereCompareValues(left, right)
+	if !ok {
+		return false
+	}
+	switch n.op {
+	case ">":
+		return cmp > 0
+	case ">=":
+		return cmp >= 0
+	case "<":
+		return cmp < 0
+	default:
+		return cmp <= 0
+	}
+}
+
+// 数字与数字字符串按数值比较
+func whereNumbers(left, right interface{}) (float64, float64, bool) {
+	ln, lok := schemaNumber(left)
+	rn, rok := schemaNumber(right)
+	if lok == rok {
+		return ln, rn, lok
+	}
+	if lok {
+		rn, rok = whereParseNumber(right)
+	} else {
+		ln, lok = whereParseNumber(left)
+	}
+	return ln, rn, lok && rok
+}
+
+func whereParseNumber(val interface{}) (float64, bool) {
+	if s, ok := val.(string); ok {
+		f, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+		return f, nil == err
+	}
+	return 0, false
+}
+
+func whereEquals(left, right interface{}) bool {
+	if ln, rn, ok := whereNumbers(left, right); ok {
+		return ln == rn
+	}
+	return reflect.DeepEqual(left, right)
+}
+
+func whereCompareValues(left, right interface{}) (int, bool) {
+	if ln, rn, ok := whereNumbers(left, right); ok {
+		switch {
+		case ln < rn:
+			return -1, true
+		case ln > rn:
+			return 1, true
+		default:
+			return 0, true
+		}
+	}
+	ls, lok := left.(string)
+	rs, rok := right.(string)
+	if lok && rok {
+		return strings.Compare(ls, rs), true
+	}
+	return 0, false
+}
+
+func whereTruthy(val interface{}) bool {
+	switch v := val.(type) {
+	case nil:
+		return false
+	case bool:
+		return v
+	case string:
+		return "" != v
+	}
+	if n, ok := schemaNumber(val); ok {
+		return 0 != n
+	}
+	return true
+}
+
+////
+
+const (
+	whereTokenIdent = iota
+	whereTokenString
+	whereTokenNumber
+	whereTokenOp
+)
+
+type whereToken struct {
+	kind int
+	text string
+	str  string // 字符串字面量的值
+}
+
+var whereOperators = []string{"&&", "||", "==", "!=", ">=", "<=", ">", "<", "!", "(", ")"}
+
+func lexWhere(expr string) ([]whereToken, error) {
+	tokens := make([]whereToken, 0)
+	for i := 0; i < len(expr); {
+		c := expr[i]
+		switch {
+		case ' ' == c || '\t' == c || '\n' == c || '\r' == c:
+			i++
+		case '"' == c || '\'' == c:
+			end := i + 1
+			for ; end < len(expr) && expr[end] != c; end++ {
+				if '\\' == expr[end] {
+					end++
+				}
+			}
+			if end >= len(expr) {
+				return nil, errors.Errorf("where: unterminated string in: %s", expr)
+			}
+			// 双引号字符串支持Go转义字符；单引号字符串只支持 \' 转义
+			str := strings.Replace(expr[i+1:end], `\'`, `'`, -1)
+			if '"' == c {
+				var err error
+				if str, err = strconv.Unquote(expr[i : end+1]); nil != err {
+					return nil, errors.Errorf("where: invalid string %s in: %s", expr[i:end+1], expr)
+				}
+			}
+			tokens = append(tokens, whereToken{kind: whereTokenString, text: expr[i : end+1], str: str})
+			i = end + 1
+		case ('0' <= c && c <= '9') || ('-' == c && i+1 < len(expr) && '0' <= expr[i+1] && expr[i+1] <= '9'):
+			end := i + 1
+			for ; end < len(expr) && strings.IndexByte("0123456789.eE", expr[end]) >= 0; end++ {
+			}
+			tokens = append(tokens, whereToken{kind: whereTokenNumber, text: expr[i:end]})
+			i = end
+		case isWhereIdentChar(c, true):
+			end := i + 1
+			for ; end < len(expr) && isWhereIdentChar(expr[end], false); end++ {
+			}
+			tokens = append(tokens, whereToken{kind: whereTokenIdent, text: expr[i:end]})
+			i = end
+		default:
+			matched := false
+			for _, op := range whereOperators {
+				if strings.HasPrefix(expr[i:], op) {
+					tokens = append(tokens, whereToken{kind: whereTokenOp, text: op})
+					i += len(op)
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				return nil, errors.Errorf("where: unexpected character %q in: %s", c, expr)
+			}
+		}
+	}
+	return tokens, nil
+}
+
+func isWhereIdentChar(c byte, first bool) bool {
+	if '_' == c || '@' == c || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') {
+		return true
+	}
+	return !first && (('0' <= c && c <= '9') || '.' == c || '[' == c || ']' == c)
+}
+
+type whereParser struct {
+	tokens []whereToken
+	pos    int
+}
+
+func (p *whereParser) peekOp(op string) bool {
+	return p.pos < len(p.tokens) && whereTokenOp == p.tokens[p.pos].kind && op == p.tokens[p.pos].text
+}
+
+func (p *whereParser) parseOr() (whereNode, error) {
+	left, err := p.parseAnd()
+	for nil == err && p.peekOp("||") {
+		p.pos++
+		var right whereNode
+		if right, err = p.parseAnd(); nil == err {
+			left = &whereLogic{and: false, left: left, right: right}
+		}
+	}
+	return left, err
+}
+
+func (p *whereParser) parseAnd() (whereNode, error) {
+	left, err := p.parseNot()
+	for nil == err && p.peekOp("&&") {
+		p.pos++
+		var right whereNode
+		if right, err = p.parseNot(); nil == err {
+			left = &whereLogic{and: true, left: left, right: right}
+		}
+	}
+	return left, err
+}
+
+func (p *whereParser) parseNot() (whereNode, error) {
+	if p.peekOp("!") {
+		p.pos++
+		node, err := p.parseNot()
+		if nil != err {
+			return nil, err
+		}
+		return &whereNot{node: node}, nil
+	}
+	return p.parseCompare()
+}
+
+func (p *whereParser) parseCompare() (whereNode, error) {
+	left, err := p.parsePrimary()
+	if nil != err {
+		return nil, err
+	}
+	for _, op := range []string{"==", "!=", ">=", "<=", ">", "<"} {
+		if p.peekOp(op) {
+			p.pos++
+			right, err := p.parsePrimary()
+			if nil != err {
+				return nil, err
+			}
+			return &whereCompare{op: op, left: left, right: right}, nil
+		}
+	}
+	return left, nil
+}
+
+func (p *whereParser) parsePrimary() (whereNode, error) {
+	if p.pos >= len(p.tokens) {
+		return nil, errors.New("where: unexpected end of expression")
+	}
+	tk := p.tokens[p.pos]
+	p.pos++
+	switch tk.kind {
+	case whereTokenString:
+		return &whereLiteral{value: tk.str}, nil
+	case whereTokenNumber:
+		f, err := strconv.ParseFloat(tk.text, 64)
+		if nil != err {
+			return nil, errors.Errorf("where: invalid number: %s", tk.text)
+		}
+		return &whereLiteral{value: f}, nil
+	case whereTokenIdent:
+		switch {
+		case "true" == tk.text:
+			return &whereLiteral{value: true}, nil
+		case "false" == tk.text:
+			return &whereLiteral{value: false}, nil
+		case "null" == tk.text:
+			return &whereLiteral{value: nil}, nil
+		case strings.HasPrefix(tk.text, "attrs.") && len(tk.text) > len("attrs."):
+			return &whereAttr{key: tk.text[len("attrs."):]}, nil
+		case strings.HasPrefix(tk.text, "vars.") && len(tk.text) > len("vars."):
+			return &whereTopicVar{name: tk.text[len("vars."):]}, nil
+		}
+		tokens, err := parseFieldPath(tk.text)
+		if nil != err {
+			return nil, errors.WithMessage(err, "where: invalid field path "+tk.text)
+		}
+		return &whereField{tokens: tokens}, nil
+	}
+	if "(" == tk.text {
+		node, err := p.parseOr()
+		if nil != err {
+			return nil, err
+		}
+		if !p.peekOp(")") {
+			return nil, errors.New("where: missing ')'")
+		}
+		p.pos++
+		return node, nil
+	}
+	return nil, errors.Errorf("where: unexpected token %q", tk.text)
+}
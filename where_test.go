@@ -0,0 +1,55 @@
+package gecko
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestWhereExprMatch(t *testing.T) {
+	msg := NewMessagePacketFields(map[string]interface{}{
+		"event":  "swipe",
+		"door":   int64(3),
+		"card":   "0012",
+		"reader": map[string]interface{}{"tags": []interface{}{"in", "vip"}, "online": true},
+	})
+	attrs := NewAttributesWith(map[string]interface{}{
+		"user":           "admin",
+		TopicVarsAttrKey: map[string]string{"building": "7"},
+	})
+	cases := []struct {
+		expr   string
+		expect bool
+	}{
+		{`event == "swipe" && door > 2`, true},
+		{`event == 'swipe' && door > 3`, false},
+		{`event != "swipe" || door >= 3`, true},
+		{`!(door < 3) && reader.online`, true},
+		{`reader.tags[1] == "vip"`, true},
+		{`reader.tags[5] == null`, true},
+		{`missing`, false},
+		{`!missing && card`, true},
+		{`card == 12`, true},
+		{`card == "12"`, false},
+		{`card < "01"`, true},
+		{`attrs.user == "admin" && vars.building > 5`, true},
+		{`vars.door == null`, true},
+		{`door > "x"`, false},
+		{`door == -3 || door <= 3.5`, true},
+		{`event == "say \"hi\""`, false},
+	}
+	for _, c := range cases {
+		w, err := ParseWhereExpr(c.expr)
+		assert.NoError(t, err, c.expr)
+		assert.Equal(t, c.expect, w.Match(attrs, msg), c.expr)
+	}
+
+	var none *WhereExpr
+	assert.True(t, none.Match(attrs, msg))
+}
+
+func TestParseWhereExprInvalid(t *testing.T) {
+	for _, expr := range []string{``, `door >`, `(door > 1`, `door > 1)`, `event == "swipe`, `door = 1`, `door > 1 2`, `a.[`} {
+		_, err := ParseWhereExpr(expr)
+		assert.Error(t, err, expr)
+	}
+}